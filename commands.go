@@ -0,0 +1,406 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// Exit codes for non-interactive commands
+const (
+	exitOK      = 0
+	exitFailure = 1 // One or more addons or installations failed
+	exitUsage   = 2 // Bad arguments, unknown names or unreadable config
+)
+
+// Flag value that collects every occurrence of a repeated flag
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// Parse flags that may appear before, between or after positional arguments
+func parseInterspersed(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional, nil
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+// Run a non-interactive command, returning the process exit code
+func runCommand(name string, args []string) int {
+	switch name {
+	case "install":
+		return runInstallCommand(name, args)
+	case "update":
+		return runInstallCommand(name, args)
+	case "list":
+		return runListCommand(args)
+	case "remove":
+		return runRemoveCommand(args)
+	case "enable":
+		return runSetDisabledCommand(name, args, false)
+	case "disable":
+		return runSetDisabledCommand(name, args, true)
+	case "backup":
+		return runBackupCommand(args)
+	case "restore":
+		return runRestoreCommand(args)
+	case "prune":
+		return runPruneCommand(args)
+	case "export":
+		return runExportCommand(args)
+	case "ignore":
+		return runIgnoreCommand(args)
+	}
+
+	fmt.Printf("Error: unknown command '%s'\n", name)
+	return exitUsage
+}
+
+// Load config for a command, selecting installations by --dir names
+func loadCommandConfig(dirNames []string) (Config, error) {
+	config, err := loadConfig("config.json")
+	if err != nil {
+		return nil, fmt.Errorf("error loading config: %v", err)
+	}
+	return selectDirectories(config, dirNames)
+}
+
+func selectDirectories(config Config, dirNames []string) (Config, error) {
+	if len(dirNames) == 0 {
+		return config, nil
+	}
+
+	var selected Config
+	for _, name := range dirNames {
+		found := false
+		for _, dir := range config {
+			if strings.EqualFold(dir.Name, name) {
+				selected = append(selected, dir)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("installation '%s' not found in config", name)
+		}
+	}
+	return selected, nil
+}
+
+func isSelectedDirectory(dir DirectoryConfig, dirNames []string) bool {
+	if len(dirNames) == 0 {
+		return true
+	}
+	for _, name := range dirNames {
+		if strings.EqualFold(dir.Name, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// Check every addon name exists in at least one of the installations
+func checkAddonNames(config Config, names []string) error {
+	for _, name := range names {
+		found := false
+		for _, dir := range config {
+			if len(filterAddons(dir.Addons, []string{name})) > 0 {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("addon '%s' not found in config", name)
+		}
+	}
+	return nil
+}
+
+func runInstallCommand(name string, args []string) int {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	var dirNames stringList
+	fs.Var(&dirNames, "dir", "only process this installation (repeatable)")
+	force := fs.Bool("force", false, "uninstall disabled addons even if others depend on them")
+	jobs := fs.Int("jobs", 0, "number of concurrent downloads")
+	refresh := fs.Bool("refresh", false, "download every archive again instead of revalidating the cached one")
+
+	names, err := parseInterspersed(fs, args)
+	if err != nil {
+		return exitUsage
+	}
+
+	config, err := loadCommandConfig(dirNames)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return exitUsage
+	}
+	if err := checkAddonNames(config, names); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return exitUsage
+	}
+
+	// Only visit installations that configure one of the named addons
+	if len(names) > 0 {
+		var selected Config
+		for _, dir := range config {
+			matched := filterAddons(dir.Addons, names)
+			if len(matched) == 0 {
+				continue
+			}
+			for _, addon := range matched {
+				if addon.Disabled {
+					fmt.Printf("Error: %s is disabled in %s, run 'aggon enable %s' first\n", addon.Name, dir.Name, addon.Name)
+					return exitUsage
+				}
+			}
+			selected = append(selected, dir)
+		}
+		config = selected
+	}
+
+	summary := installAllAddons(config, InstallOptions{
+		Force:       *force,
+		Refresh:     *refresh,
+		Concurrency: *jobs,
+		Addons:      names,
+	})
+	if summary.Failed > 0 || summary.DirErrors > 0 {
+		return exitFailure
+	}
+	return exitOK
+}
+
+func runListCommand(args []string) int {
+	fs := flag.NewFlagSet("list", flag.ContinueOnError)
+	var dirNames stringList
+	fs.Var(&dirNames, "dir", "only list this installation (repeatable)")
+
+	if _, err := parseInterspersed(fs, args); err != nil {
+		return exitUsage
+	}
+
+	config, err := loadCommandConfig(dirNames)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return exitUsage
+	}
+
+	for _, dir := range config {
+		fmt.Printf("📂 %s (%d addons)\n", dir.Name, len(dir.Addons))
+		fmt.Printf("   %s\n", dir.Path)
+
+		aggonDir := filepath.Join(filepath.Dir(dir.Path), "Aggon")
+		manifest := loadManifest(aggonDir)
+
+		for _, addon := range dir.Addons {
+			installed := addonExists(addon, dir.Path, manifest)
+			version := ""
+			if installed {
+				version = formatVersionSuffix(installedVersion(addon, dir.Path, manifest))
+			}
+
+			switch {
+			case addon.Disabled && installed:
+				fmt.Printf("   ⏸️  %s%s - disabled, still installed\n", addon.Name, version)
+			case addon.Disabled:
+				fmt.Printf("   ⏸️  %s - disabled\n", addon.Name)
+			case installed:
+				fmt.Printf("   ✅ %s%s\n", addon.Name, version)
+			default:
+				fmt.Printf("   ⬜ %s - not installed\n", addon.Name)
+			}
+		}
+		fmt.Println()
+	}
+
+	return exitOK
+}
+
+func runRemoveCommand(args []string) int {
+	fs := flag.NewFlagSet("remove", flag.ContinueOnError)
+	var dirNames stringList
+	fs.Var(&dirNames, "dir", "only remove from this installation (repeatable)")
+	force := fs.Bool("force", false, "remove even if other enabled addons depend on it")
+
+	names, err := parseInterspersed(fs, args)
+	if err != nil {
+		return exitUsage
+	}
+	if len(names) == 0 {
+		fmt.Println("Usage: aggon remove [--dir NAME] [--force] <addon>...")
+		return exitUsage
+	}
+
+	fullConfig, err := loadConfig("config.json")
+	if err != nil {
+		fmt.Printf("Error: error loading config: %v\n", err)
+		return exitUsage
+	}
+	selected, err := selectDirectories(fullConfig, dirNames)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return exitUsage
+	}
+	if err := checkAddonNames(selected, names); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return exitUsage
+	}
+
+	exitCode := exitOK
+	for i := range fullConfig {
+		dir := &fullConfig[i]
+		if !isSelectedDirectory(*dir, dirNames) {
+			continue
+		}
+
+		aggonDir := filepath.Join(filepath.Dir(dir.Path), "Aggon")
+		backupDir := filepath.Join(aggonDir, "Backups")
+		manifest := loadManifest(aggonDir)
+		graph := buildDependencyGraph(*dir, manifest, nil)
+
+		var kept []AddonConfig
+		backedUp, uninstalled := false, false
+		for _, addon := range dir.Addons {
+			if len(filterAddons([]AddonConfig{addon}, names)) == 0 {
+				kept = append(kept, addon)
+				continue
+			}
+
+			if dependents := findDependents(graph, addon); len(dependents) > 0 && !*force {
+				fmt.Printf("⛔ %s (%s) - Not removed, still required by %s\n", addon.Name, dir.Name, strings.Join(dependents, ", "))
+				kept = append(kept, addon)
+				exitCode = exitFailure
+				continue
+			}
+
+			if addonExists(addon, dir.Path, manifest) {
+				// Back up once per installation before deleting anything
+				if !backedUp {
+					if err := setupAggonDirectories(aggonDir, backupDir); err == nil {
+						decisions, err := backupFullDirectory(*dir, backupDir)
+						if err != nil {
+							fmt.Printf("⚠️  Pre-removal backup of %s failed: %v\n", dir.Name, err)
+						}
+						printPruneDecisions(decisions, "", false)
+					}
+					backedUp = true
+				}
+
+				if err := uninstallAddon(addon, dir.Path, manifest); err != nil {
+					fmt.Printf("❌ %s (%s) - Uninstall Error: %v\n", addon.Name, dir.Name, err)
+					kept = append(kept, addon)
+					exitCode = exitFailure
+					continue
+				}
+				uninstalled = true
+			}
+
+			fmt.Printf("🗑️  %s (%s) - Removed\n", addon.Name, dir.Name)
+		}
+
+		dir.Addons = kept
+		if uninstalled {
+			if err := saveManifest(aggonDir, manifest); err != nil {
+				fmt.Printf("⚠️  Failed to save install manifest for %s: %v\n", dir.Name, err)
+			}
+		}
+	}
+
+	if err := saveConfig("config.json", fullConfig); err != nil {
+		fmt.Printf("Error: failed to save config: %v\n", err)
+		return exitFailure
+	}
+	return exitCode
+}
+
+func runSetDisabledCommand(name string, args []string, disabled bool) int {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	var dirNames stringList
+	fs.Var(&dirNames, "dir", "only change this installation (repeatable)")
+
+	names, err := parseInterspersed(fs, args)
+	if err != nil {
+		return exitUsage
+	}
+	if len(names) == 0 {
+		fmt.Printf("Usage: aggon %s [--dir NAME] <addon>...\n", name)
+		return exitUsage
+	}
+
+	fullConfig, err := loadConfig("config.json")
+	if err != nil {
+		fmt.Printf("Error: error loading config: %v\n", err)
+		return exitUsage
+	}
+	selected, err := selectDirectories(fullConfig, dirNames)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return exitUsage
+	}
+	if err := checkAddonNames(selected, names); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return exitUsage
+	}
+
+	for i := range fullConfig {
+		dir := &fullConfig[i]
+		if !isSelectedDirectory(*dir, dirNames) {
+			continue
+		}
+
+		for j := range dir.Addons {
+			addon := &dir.Addons[j]
+			if len(filterAddons([]AddonConfig{*addon}, names)) == 0 {
+				continue
+			}
+			addon.Disabled = disabled
+			fmt.Printf("✅ %s (%s) - %sd\n", addon.Name, dir.Name, name)
+		}
+	}
+
+	if err := saveConfig("config.json", fullConfig); err != nil {
+		fmt.Printf("Error: failed to save config: %v\n", err)
+		return exitFailure
+	}
+
+	fmt.Println("Run 'aggon install' to apply the change.")
+	return exitOK
+}
+
+func runBackupCommand(args []string) int {
+	fs := flag.NewFlagSet("backup", flag.ContinueOnError)
+	var dirNames stringList
+	fs.Var(&dirNames, "dir", "only back up this installation (repeatable)")
+
+	if _, err := parseInterspersed(fs, args); err != nil {
+		return exitUsage
+	}
+
+	config, err := loadCommandConfig(dirNames)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return exitUsage
+	}
+
+	if _, failed := backupAllAddons(config); failed > 0 {
+		return exitFailure
+	}
+	return exitOK
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+)
+
+// Credentials file beside config.json, so tokens can stay out of the shared config
+const credentialsFile = "credentials.json"
+
+// Environment variables holding API keys when config doesn't set them, checked in order
+var apiKeyEnvironment = map[string][]string{
+	providerGitHub:     {"GITHUB_TOKEN", "GH_TOKEN"},
+	providerCurseForge: {"CURSEFORGE_API_KEY"},
+	providerWago:       {"WAGO_API_KEY"},
+}
+
+var (
+	credentialsOnce sync.Once
+	credentials     map[string]string
+)
+
+// Load API keys by provider from the credentials file, once per run
+func loadCredentials() map[string]string {
+	credentialsOnce.Do(func() {
+		data, err := os.ReadFile(credentialsFile)
+		if err != nil {
+			return
+		}
+		json.Unmarshal(data, &credentials)
+	})
+	return credentials
+}
+
+// API key for a provider from the installation's config, the environment or
+// the credentials file, in that order
+func providerAPIKey(dir DirectoryConfig, provider string) string {
+	if key := dir.APIKeys[provider]; key != "" {
+		return key
+	}
+	for _, env := range apiKeyEnvironment[provider] {
+		if key := os.Getenv(env); key != "" {
+			return key
+		}
+	}
+	return loadCredentials()[provider]
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Dependency information for one configured addon
+type addonDeps struct {
+	addon    AddonConfig
+	provides map[string]bool // Lowercase folder names
+	requires []string        // Required folders from the TOC files, excluding its own
+}
+
+// Build the dependency graph of a directory's addons from their installed
+// TOC files, or from the fetched archives in upcoming for addons about to be
+// installed, so new or changed dependencies count before extraction
+func buildDependencyGraph(dir DirectoryConfig, manifest Manifest, upcoming map[string]ArchiveContents) []addonDeps {
+	var graph []addonDeps
+
+	for _, addon := range dir.Addons {
+		node := addonDeps{addon: addon, provides: make(map[string]bool)}
+
+		folders := installedFolders(addon, dir.Path, manifest)
+		var tocs []TocInfo
+		if contents, exists := upcoming[addon.Name]; exists {
+			folders, tocs = contents.Folders, contents.Tocs
+		} else {
+			tocs = readAddonTocs(addon, dir.Path, manifest)
+		}
+
+		node.provides[strings.ToLower(addon.Name)] = true
+		if addon.Folder != "" {
+			node.provides[strings.ToLower(addon.Folder)] = true
+		}
+		for _, folder := range folders {
+			node.provides[strings.ToLower(folder)] = true
+		}
+
+		seen := make(map[string]bool)
+		for _, toc := range tocs {
+			for _, dep := range toc.RequiredDeps {
+				lower := strings.ToLower(dep)
+				if node.provides[lower] || seen[lower] {
+					continue
+				}
+				seen[lower] = true
+				node.requires = append(node.requires, dep)
+			}
+		}
+
+		graph = append(graph, node)
+	}
+
+	return graph
+}
+
+// Find the configured addon providing a folder, preferring enabled ones
+func findProvider(graph []addonDeps, folder string) *addonDeps {
+	lower := strings.ToLower(folder)
+	var disabled *addonDeps
+	for i := range graph {
+		if !graph[i].provides[lower] {
+			continue
+		}
+		if !graph[i].addon.Disabled {
+			return &graph[i]
+		}
+		if disabled == nil {
+			disabled = &graph[i]
+		}
+	}
+	return disabled
+}
+
+// Built-in addons ship with the game client and are never configured
+func isBuiltinAddon(folder string) bool {
+	return strings.HasPrefix(strings.ToLower(folder), "blizzard_")
+}
+
+// Check required dependencies of enabled addons, returning problems per addon name
+func checkDependencies(dir DirectoryConfig, graph []addonDeps) map[string][]string {
+	problems := make(map[string][]string)
+
+	for _, node := range graph {
+		if node.addon.Disabled {
+			continue
+		}
+
+		for _, dep := range node.requires {
+			if isBuiltinAddon(dep) {
+				continue
+			}
+
+			provider := findProvider(graph, dep)
+			if provider != nil {
+				if provider.addon.Disabled {
+					problems[node.addon.Name] = append(problems[node.addon.Name],
+						fmt.Sprintf("requires %s, but %s is disabled", dep, provider.addon.Name))
+				}
+				continue
+			}
+
+			// Addons installed outside of Aggon still satisfy the dependency
+			if _, err := os.Stat(filepath.Join(dir.Path, dep)); err == nil {
+				continue
+			}
+
+			problems[node.addon.Name] = append(problems[node.addon.Name],
+				fmt.Sprintf("requires %s, which is not configured", dep))
+		}
+	}
+
+	return problems
+}
+
+// Order addons so dependencies are installed before the addons needing them,
+// keeping config order otherwise. Addons in a cycle keep their config order.
+func orderAddonsByDependencies(graph []addonDeps) ([]AddonConfig, []string) {
+	// Map each addon to the indexes of the addons it depends on
+	dependsOn := make([]map[int]bool, len(graph))
+	for i, node := range graph {
+		dependsOn[i] = make(map[int]bool)
+		for _, dep := range node.requires {
+			provider := findProvider(graph, dep)
+			if provider == nil {
+				continue
+			}
+			for j := range graph {
+				if &graph[j] == provider && j != i {
+					dependsOn[i][j] = true
+				}
+			}
+		}
+	}
+
+	var ordered []AddonConfig
+	placed := make([]bool, len(graph))
+	for len(ordered) < len(graph) {
+		progress := false
+		for i := range graph {
+			if placed[i] || !allPlaced(dependsOn[i], placed) {
+				continue
+			}
+			placed[i] = true
+			ordered = append(ordered, graph[i].addon)
+			progress = true
+			break // Restart so earlier config entries keep priority
+		}
+
+		if !progress {
+			break
+		}
+	}
+
+	// Anything left is part of a dependency cycle
+	var cycle []string
+	for i := range graph {
+		if !placed[i] {
+			ordered = append(ordered, graph[i].addon)
+			cycle = append(cycle, graph[i].addon.Name)
+		}
+	}
+
+	return ordered, cycle
+}
+
+func allPlaced(indexes map[int]bool, placed []bool) bool {
+	for i := range indexes {
+		if !placed[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Get the enabled addons that still require something the given addon provides
+func findDependents(graph []addonDeps, addon AddonConfig) []string {
+	var provides map[string]bool
+	for _, node := range graph {
+		if node.addon.Name == addon.Name {
+			provides = node.provides
+			break
+		}
+	}
+
+	var dependents []string
+	for _, node := range graph {
+		if node.addon.Disabled || node.addon.Name == addon.Name {
+			continue
+		}
+		for _, dep := range node.requires {
+			lower := strings.ToLower(dep)
+			if !provides[lower] {
+				continue
+			}
+
+			// Another enabled addon providing the same folder takes over
+			if provider := findProvider(graph, dep); provider != nil && !provider.addon.Disabled {
+				continue
+			}
+
+			dependents = append(dependents, node.addon.Name)
+			break
+		}
+	}
+
+	sort.Strings(dependents)
+	return dependents
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Default extraction limits, far above any real addon but low enough to stop
+// a zip bomb before it fills the disk
+const (
+	defaultMaxExtractSize  = 2 << 30 // 2 GB uncompressed
+	defaultMaxExtractFiles = 50000
+)
+
+// ExtractLimits bounds what extracting a single archive may write
+type ExtractLimits struct {
+	MaxSize  int64 // Total uncompressed bytes
+	MaxFiles int   // Number of file entries
+}
+
+// Get the extraction limits of an installation, filling in defaults
+func extractLimits(dir DirectoryConfig) ExtractLimits {
+	limits := ExtractLimits{MaxSize: int64(dir.MaxExtractSizeMB) << 20, MaxFiles: dir.MaxExtractFiles}
+	return limits.withDefaults()
+}
+
+func (l ExtractLimits) withDefaults() ExtractLimits {
+	if l.MaxSize <= 0 {
+		l.MaxSize = defaultMaxExtractSize
+	}
+	if l.MaxFiles <= 0 {
+		l.MaxFiles = defaultMaxExtractFiles
+	}
+	return l
+}
+
+// Matches Windows drive letters like C: at the start of a path
+var driveLetterPrefix = regexp.MustCompile(`^[A-Za-z]:`)
+
+// Clean an archive entry name into a relative slash-separated path.
+// Absolute paths, drive letters and entries climbing out with ".." are
+// rejected rather than fixed, an archive containing them isn't trustworthy.
+func sanitizeArchivePath(name string) (string, error) {
+	cleaned := strings.ReplaceAll(name, "\\", "/")
+	if strings.HasPrefix(cleaned, "/") || driveLetterPrefix.MatchString(cleaned) {
+		return "", fmt.Errorf("archive entry '%s' has an absolute path", name)
+	}
+	for _, part := range strings.Split(cleaned, "/") {
+		if part == ".." {
+			return "", fmt.Errorf("archive entry '%s' points outside the addon", name)
+		}
+	}
+
+	cleaned = path.Clean(cleaned)
+	if cleaned == "." {
+		return "", nil
+	}
+	return cleaned, nil
+}
+
+// Get the single folder every entry of the archive is in, like the root
+// folder of GitHub style archives, or "" if there is no such wrapper folder
+func archiveRootFolder(files []*zip.File) string {
+	root := ""
+	for _, file := range files {
+		name, err := sanitizeArchivePath(file.Name)
+		if err != nil || name == "" {
+			continue
+		}
+		folder, _, inFolder := strings.Cut(name, "/")
+		if !inFolder && !file.FileInfo().IsDir() {
+			return ""
+		}
+		if root == "" {
+			root = folder
+		} else if folder != root {
+			return ""
+		}
+	}
+	return root
+}
+
+// Check every entry of an archive before anything is written: names must be
+// safe, symlinks aren't allowed and the declared sizes and entry count must
+// stay within the limits
+func checkArchiveEntries(files []*zip.File, limits ExtractLimits) error {
+	var totalSize uint64
+	fileCount := 0
+	for _, file := range files {
+		if file.Mode()&os.ModeSymlink != 0 {
+			return fmt.Errorf("archive entry '%s' is a symlink", file.Name)
+		}
+		if _, err := sanitizeArchivePath(file.Name); err != nil {
+			return err
+		}
+		if file.FileInfo().IsDir() {
+			continue
+		}
+
+		fileCount++
+		if fileCount > limits.MaxFiles {
+			return fmt.Errorf("archive has more than %d files (max_extract_files)", limits.MaxFiles)
+		}
+		totalSize += file.UncompressedSize64
+		if totalSize > uint64(limits.MaxSize) {
+			return fmt.Errorf("archive unpacks to more than %s (max_extract_size_mb)", formatSize(limits.MaxSize))
+		}
+	}
+	return nil
+}
+
+// Join a relative path onto a root, making sure the result stays inside it
+func containedPath(root, relPath string) (string, error) {
+	joined := filepath.Join(root, filepath.FromSlash(relPath))
+	rel, err := filepath.Rel(root, joined)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) || filepath.IsAbs(rel) {
+		return "", fmt.Errorf("'%s' resolves outside %s", relPath, root)
+	}
+	return joined, nil
+}
+
+// Budget of bytes left to extract. Declared sizes can lie, so the limit is
+// also enforced on what is actually decompressed.
+type extractBudget struct {
+	remaining int64
+	limit     int64
+}
+
+// Copy an entry's contents, failing once the archive's total exceeds the limit
+func (b *extractBudget) copy(dst io.Writer, src io.Reader) error {
+	written, err := io.Copy(dst, io.LimitReader(src, b.remaining+1))
+	b.remaining -= written
+	if err != nil {
+		return err
+	}
+	if b.remaining < 0 {
+		return fmt.Errorf("archive unpacks to more than %s (max_extract_size_mb)", formatSize(b.limit))
+	}
+	return nil
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/flate"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSanitizeArchivePath(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    string
+		wantErr string
+	}{
+		{"MyAddon/Core.lua", "MyAddon/Core.lua", ""},
+		{"./MyAddon//Core.lua", "MyAddon/Core.lua", ""},
+		{"MyAddon/", "MyAddon", ""},
+		{"MyAddon\\Libs\\LibStub.lua", "MyAddon/Libs/LibStub.lua", ""},
+		{".", "", ""},
+		{"../evil.lua", "", "outside"},
+		{"MyAddon/../../evil.lua", "", "outside"},
+		{"MyAddon\\..\\..\\evil.lua", "", "outside"},
+		{"MyAddon/..", "", "outside"},
+		{"/etc/passwd", "", "absolute"},
+		{"\\Windows\\evil.dll", "", "absolute"},
+		{"\\\\server\\share\\evil.lua", "", "absolute"},
+		{"C:/Windows/evil.dll", "", "absolute"},
+		{"c:evil.lua", "", "absolute"},
+		{"D:\\evil.lua", "", "absolute"},
+	}
+	for _, test := range tests {
+		got, err := sanitizeArchivePath(test.name)
+		if test.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+				t.Errorf("%q: got %q, %v, want an error about %s", test.name, got, err, test.wantErr)
+			}
+			continue
+		}
+		if err != nil || got != test.want {
+			t.Errorf("%q: got %q, %v, want %q", test.name, got, err, test.want)
+		}
+	}
+}
+
+// Entry of a test archive, with the size its header declares if not the real one
+type testEntry struct {
+	name     string
+	content  string
+	mode     os.FileMode
+	declared int
+}
+
+// Build an archive whose headers say what the entries claim to be
+func craftArchive(t *testing.T, entries ...testEntry) []byte {
+	t.Helper()
+	var buffer bytes.Buffer
+	writer := zip.NewWriter(&buffer)
+	for _, entry := range entries {
+		header := &zip.FileHeader{Name: entry.name, Method: zip.Deflate}
+		if entry.mode != 0 {
+			header.SetMode(entry.mode)
+		}
+
+		var compressed bytes.Buffer
+		compressor, _ := flate.NewWriter(&compressed, flate.DefaultCompression)
+		compressor.Write([]byte(entry.content))
+		compressor.Close()
+		header.CRC32 = crc32.ChecksumIEEE([]byte(entry.content))
+		header.CompressedSize64 = uint64(compressed.Len())
+		header.UncompressedSize64 = uint64(len(entry.content))
+		if entry.declared > 0 {
+			header.UncompressedSize64 = uint64(entry.declared)
+		}
+
+		file, err := writer.CreateRaw(header)
+		if err != nil {
+			t.Fatal(err)
+		}
+		file.Write(compressed.Bytes())
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buffer.Bytes()
+}
+
+func readArchive(t *testing.T, data []byte) []*zip.File {
+	t.Helper()
+	reader, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return reader.File
+}
+
+func TestCheckArchiveEntries(t *testing.T) {
+	limits := ExtractLimits{MaxSize: 100, MaxFiles: 3}
+	tests := []struct {
+		name    string
+		entries []testEntry
+		wantErr string
+	}{
+		{"plain addon", []testEntry{{name: "MyAddon/"}, {name: "MyAddon/MyAddon.toc", content: "## Title: MyAddon\n"}}, ""},
+		{"traversal", []testEntry{{name: "MyAddon/../../evil.lua", content: "x"}}, "outside"},
+		{"absolute", []testEntry{{name: "/tmp/evil.lua", content: "x"}}, "absolute"},
+		{"drive letter", []testEntry{{name: "C:\\evil.lua", content: "x"}}, "absolute"},
+		{"backslash traversal", []testEntry{{name: "MyAddon\\..\\..\\evil.lua", content: "x"}}, "outside"},
+		{"symlink", []testEntry{{name: "MyAddon/link", content: "/etc/passwd", mode: os.ModeSymlink | 0777}}, "symlink"},
+		{"too many files", []testEntry{{name: "a", content: "a"}, {name: "b", content: "b"}, {name: "c", content: "c"}, {name: "d", content: "d"}}, "more than 3 files"},
+		{"folders don't count as files", []testEntry{{name: "a/"}, {name: "b/"}, {name: "c/"}, {name: "a/x", content: "x"}}, ""},
+		{"declared too large", []testEntry{{name: "big", content: strings.Repeat("x", 101)}}, "max_extract_size_mb"},
+		{"declared too large together", []testEntry{{name: "a", content: strings.Repeat("x", 60)}, {name: "b", content: strings.Repeat("x", 60)}}, "max_extract_size_mb"},
+	}
+	for _, test := range tests {
+		err := checkArchiveEntries(readArchive(t, craftArchive(t, test.entries...)), limits)
+		if test.wantErr == "" {
+			if err != nil {
+				t.Errorf("%s: %v", test.name, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+			t.Errorf("%s: got %v, want an error about %s", test.name, err, test.wantErr)
+		}
+	}
+}
+
+func TestExtractBudget(t *testing.T) {
+	budget := &extractBudget{remaining: 10, limit: 10}
+	if err := budget.copy(io.Discard, strings.NewReader("123456")); err != nil {
+		t.Fatal(err)
+	}
+	if err := budget.copy(io.Discard, strings.NewReader("1234")); err != nil {
+		t.Fatalf("exactly the limit: %v", err)
+	}
+	if err := budget.copy(io.Discard, strings.NewReader("1")); err == nil {
+		t.Errorf("copying past the limit succeeded")
+	}
+}
+
+func TestExtractZipRejectsUnderstatedSizes(t *testing.T) {
+	// Declares 10 bytes but unpacks to far more than the limit
+	data := craftArchive(t,
+		testEntry{name: "MyAddon/MyAddon.toc", content: "## Title: MyAddon\n"},
+		testEntry{name: "MyAddon/Bomb.lua", content: strings.Repeat("x", 1<<20), declared: 10},
+	)
+	archivePath := filepath.Join(t.TempDir(), "bomb.zip")
+	if err := os.WriteFile(archivePath, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	dest := t.TempDir()
+	addon := AddonConfig{Name: "MyAddon", Limits: ExtractLimits{MaxSize: 1024, MaxFiles: 10}}
+	if err := checkArchiveEntries(readArchive(t, data), addon.Limits); err != nil {
+		t.Fatalf("declared sizes should pass the check: %v", err)
+	}
+	if _, err := extractZip(archivePath, dest, addon); err == nil {
+		t.Fatal("extracting an understated entry succeeded")
+	}
+	if info, err := os.Stat(filepath.Join(dest, "MyAddon", "Bomb.lua")); err == nil {
+		t.Errorf("left %d bytes of the oversized entry behind", info.Size())
+	}
+}
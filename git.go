@@ -0,0 +1,201 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Check if an addon is installed from a git clone rather than a downloaded archive
+func isGitSource(addon AddonConfig) bool {
+	return addon.Git || addon.Commit != ""
+}
+
+// Run git with the given arguments, returning its trimmed output
+func runGit(dir string, args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	// Never wait for credentials on a terminal nobody is watching
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+
+	var output bytes.Buffer
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	if err := cmd.Run(); err != nil {
+		message := strings.TrimSpace(output.String())
+		if message == "" {
+			return "", err
+		}
+		return "", fmt.Errorf("git %s: %s", args[0], message)
+	}
+	return strings.TrimSpace(output.String()), nil
+}
+
+// Clone or fetch the addon's repository into the cache, check out the
+// configured commit, tag or branch and zip the working tree into the cache.
+// The working tree is only zipped again when the resolved commit changes.
+func fetchGitArchive(addon AddonConfig, cacheDir string, cacheIndex CacheIndex) (FetchedArchive, error) {
+	if _, err := exec.LookPath("git"); err != nil {
+		return FetchedArchive{}, fmt.Errorf("git is required for git sources: %v", err)
+	}
+
+	cacheKey := getCacheKey(addon)
+	repoDir, err := filepath.Abs(gitCloneDir(cacheDir, addon.URL))
+	if err != nil {
+		return FetchedArchive{}, err
+	}
+	defer lockGitClone(repoDir)()
+
+	// A pinned commit never changes, so there's nothing to fetch once it's cached
+	if entry, exists := cacheIndex[cacheKey]; exists && addon.Commit != "" && strings.HasPrefix(entry.Commit, addon.Commit) {
+		cachedFile := filepath.Join(cacheDir, entry.Filename)
+		if _, err := os.Stat(cachedFile); err == nil {
+			return FetchedArchive{DownloadURL: addon.URL, Path: cachedFile, Entry: entry, FromCache: true}, nil
+		}
+	}
+
+	if _, err := os.Stat(filepath.Join(repoDir, ".git")); err != nil {
+		os.RemoveAll(repoDir) // Leftovers of an interrupted clone
+		if err := os.MkdirAll(filepath.Dir(repoDir), 0755); err != nil {
+			return FetchedArchive{}, err
+		}
+		if _, err := runGit(cacheDir, "clone", "--no-checkout", "--", addon.URL, repoDir); err != nil {
+			return FetchedArchive{}, fmt.Errorf("failed to clone: %v", err)
+		}
+	} else {
+		if _, err := runGit(repoDir, "fetch", "--tags", "--force", "--prune", "origin"); err != nil {
+			return FetchedArchive{}, fmt.Errorf("failed to fetch: %v", err)
+		}
+		// Follow the remote if its default branch changed
+		runGit(repoDir, "remote", "set-head", "origin", "--auto")
+	}
+
+	commit, err := resolveGitCommit(addon, repoDir)
+	if err != nil {
+		return FetchedArchive{}, err
+	}
+
+	// Same commit as the cached archive, nothing changed upstream
+	if entry, exists := cacheIndex[cacheKey]; exists && entry.Commit == commit {
+		cachedFile := filepath.Join(cacheDir, entry.Filename)
+		if _, err := os.Stat(cachedFile); err == nil {
+			entry.LastModified = time.Now()
+			return FetchedArchive{DownloadURL: addon.URL, Path: cachedFile, Entry: entry, FromCache: true}, nil
+		}
+	}
+
+	if _, err := runGit(repoDir, "checkout", "--force", "--detach", commit); err != nil {
+		return FetchedArchive{}, fmt.Errorf("failed to check out %s: %v", commit, err)
+	}
+	if _, err := runGit(repoDir, "clean", "-ffdx"); err != nil {
+		return FetchedArchive{}, fmt.Errorf("failed to clean working tree: %v", err)
+	}
+	if _, err := runGit(repoDir, "submodule", "update", "--init", "--recursive"); err != nil {
+		return FetchedArchive{}, fmt.Errorf("failed to update submodules: %v", err)
+	}
+
+	archive, err := saveToCache(addon, "file://"+filepath.ToSlash(repoDir), cacheDir, cacheIndex, false)
+	if err != nil {
+		return FetchedArchive{}, err
+	}
+	archive.DownloadURL = addon.URL
+	archive.Entry.URL = addon.URL
+	archive.Entry.Commit = commit
+	return archive, nil
+}
+
+// Get the clone directory of a repository. It only depends on the URL, so
+// changing the pinned commit, tag or branch fetches into the same clone.
+func gitCloneDir(cacheDir, repoURL string) string {
+	hash := sha256.Sum256([]byte(repoURL))
+	return filepath.Join(cacheDir, "git", hex.EncodeToString(hash[:])[:16])
+}
+
+// Locks of clones shared by addons of the same repository, which are
+// fetched concurrently
+var gitCloneLocks = struct {
+	sync.Mutex
+	locks map[string]*sync.Mutex
+}{locks: make(map[string]*sync.Mutex)}
+
+// Lock a clone for the duration of a fetch, returning the unlock function
+func lockGitClone(repoDir string) func() {
+	gitCloneLocks.Lock()
+	lock, exists := gitCloneLocks.locks[repoDir]
+	if !exists {
+		lock = &sync.Mutex{}
+		gitCloneLocks.locks[repoDir] = lock
+	}
+	gitCloneLocks.Unlock()
+
+	lock.Lock()
+	return lock.Unlock
+}
+
+// Remove clones no cached git archive was made from any more
+func cleanupGitClones(cacheDir string, cacheIndex CacheIndex) {
+	entries, err := os.ReadDir(filepath.Join(cacheDir, "git"))
+	if err != nil {
+		return
+	}
+
+	used := make(map[string]bool)
+	for _, entry := range cacheIndex {
+		if entry.Commit != "" {
+			used[filepath.Base(gitCloneDir(cacheDir, entry.URL))] = true
+		}
+	}
+	for _, entry := range entries {
+		if entry.IsDir() && !used[entry.Name()] {
+			os.RemoveAll(filepath.Join(cacheDir, "git", entry.Name()))
+		}
+	}
+}
+
+// Resolve the commit to install: the pinned commit, a tag, the highest tag
+// matching the version constraint, a branch or the remote's default branch
+func resolveGitCommit(addon AddonConfig, repoDir string) (string, error) {
+	selector, err := newTagSelector(addon)
+	if err != nil {
+		return "", err
+	}
+	channel, err := parseChannel(addon.Channel)
+	if err != nil {
+		return "", err
+	}
+
+	var ref string
+	switch {
+	case addon.Commit != "":
+		ref = addon.Commit
+	case selector != nil:
+		output, err := runGit(repoDir, "tag", "--list")
+		if err != nil {
+			return "", fmt.Errorf("failed to list tags: %v", err)
+		}
+		tag, err := selector.pick(strings.Fields(output), channel)
+		if err != nil {
+			return "", err
+		}
+		ref = "refs/tags/" + tag
+	case addon.Tag != "":
+		ref = "refs/tags/" + addon.Tag
+	case addon.Branch != "":
+		ref = "refs/remotes/origin/" + addon.Branch
+	default:
+		ref = "refs/remotes/origin/HEAD"
+	}
+
+	commit, err := runGit(repoDir, "rev-parse", "--verify", "--quiet", ref+"^{commit}")
+	if err != nil || commit == "" {
+		return "", fmt.Errorf("'%s' not found in repository", strings.TrimPrefix(ref, "refs/remotes/"))
+	}
+	return commit, nil
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// Create a git repository holding the given files and commit them
+func testRepository(t *testing.T, files map[string]string) string {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	repoDir := filepath.Join(t.TempDir(), "MyAddon")
+	for name, content := range files {
+		path := filepath.Join(repoDir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, args := range [][]string{
+		{"init", "--quiet"},
+		{"add", "--all"},
+		{"-c", "user.name=Aggon", "-c", "user.email=aggon@example.com", "commit", "--quiet", "--allow-empty", "-m", "Initial"},
+	} {
+		if _, err := runGit(repoDir, args...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return repoDir
+}
+
+// Get the names in a zip archive, sorted
+func zipNames(t *testing.T, data []byte) []string {
+	t.Helper()
+	reader, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, file := range reader.File {
+		names = append(names, file.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestZipDirectorySkipsGitMetadata(t *testing.T) {
+	root := filepath.Join(t.TempDir(), "MyAddon")
+	for name, content := range map[string]string{
+		"MyAddon.toc":          "## Title: MyAddon\n",
+		".git/config":          "[core]\n",
+		"Libs/LibStub/.git":    "gitdir: ../../.git/modules/LibStub\n",
+		"Libs/LibStub/Lib.lua": "-- LibStub\n",
+	} {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var archive bytes.Buffer
+	if err := zipDirectory(&archive, root); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"MyAddon/Libs/LibStub/Lib.lua", "MyAddon/MyAddon.toc"}
+	if got := zipNames(t, archive.Bytes()); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestFetchGitArchiveRejectsSymlinks(t *testing.T) {
+	outside := filepath.Join(t.TempDir(), "secret.txt")
+	if err := os.WriteFile(outside, []byte("secret"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	repoDir := testRepository(t, map[string]string{"MyAddon.toc": "## Title: MyAddon\n"})
+	if err := os.Symlink(outside, filepath.Join(repoDir, "Secret.lua")); err != nil {
+		t.Skipf("symlinks aren't supported: %v", err)
+	}
+	for _, args := range [][]string{
+		{"add", "--all"},
+		{"-c", "user.name=Aggon", "-c", "user.email=aggon@example.com", "commit", "--quiet", "-m", "Add symlink"},
+	} {
+		if _, err := runGit(repoDir, args...); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cacheDir := t.TempDir()
+	addon := AddonConfig{Name: "MyAddon", URL: repoDir, Git: true}
+	_, err := fetchGitArchive(addon, cacheDir, make(CacheIndex))
+	if err == nil || !strings.Contains(err.Error(), "'Secret.lua' is a symlink") {
+		t.Fatalf("got error %v, want the symlink rejected", err)
+	}
+}
+
+func TestFetchGitArchive(t *testing.T) {
+	repoDir := testRepository(t, map[string]string{
+		"MyAddon.toc": "## Title: MyAddon\n",
+		"Core.lua":    "-- Core\n",
+	})
+
+	cacheDir := t.TempDir()
+	addon := AddonConfig{Name: "MyAddon", URL: repoDir, Git: true}
+	archive, err := fetchGitArchive(addon, cacheDir, make(CacheIndex))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if archive.Entry.Commit == "" {
+		t.Errorf("no commit recorded")
+	}
+
+	data, err := os.ReadFile(archive.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cloneName := filepath.Base(gitCloneDir(cacheDir, repoDir))
+	want := []string{cloneName + "/Core.lua", cloneName + "/MyAddon.toc"}
+	if got := zipNames(t, data); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
@@ -1,3 +1,13 @@
 module aggon
 
 go 1.21
+
+require (
+	github.com/ProtonMail/go-crypto v1.1.6
+	golang.org/x/crypto v0.33.0
+)
+
+require (
+	github.com/cloudflare/circl v1.3.7 // indirect
+	golang.org/x/sys v0.30.0 // indirect
+)
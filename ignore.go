@@ -0,0 +1,240 @@
+package main
+
+import (
+	"archive/zip"
+	"flag"
+	"fmt"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Ignore lists follow .gitignore rules: patterns without a slash match a
+// name at any depth, those with one are anchored to the archive root, a
+// trailing slash only matches folders, "**" spans folders and "!" brings
+// back files an earlier pattern excluded. Like git, a file can't be brought
+// back once a folder it lives in is excluded. Paths are relative to the
+// root folder every file of the archive is in, like GitHub's, or to the
+// archive itself when there's none, e.g. "README.md", "Libs/**/tests/" or
+// "/Details_Options/README.md".
+
+type ignoreRule struct {
+	pattern string // As configured, for messages
+	regex   *regexp.Regexp
+	negate  bool
+	dirOnly bool
+}
+
+// IgnoreMatcher decides which archive files an addon's ignore list excludes
+type IgnoreMatcher struct {
+	rules []ignoreRule
+}
+
+func compileIgnorePatterns(patterns []string) (*IgnoreMatcher, error) {
+	matcher := &IgnoreMatcher{}
+	for _, pattern := range patterns {
+		rule := ignoreRule{pattern: pattern}
+		value := strings.TrimRight(filepath.ToSlash(pattern), " ")
+		if value == "" || strings.HasPrefix(value, "#") {
+			continue
+		}
+
+		if strings.HasPrefix(value, "!") {
+			rule.negate = true
+			value = value[1:]
+		} else if strings.HasPrefix(value, `\!`) || strings.HasPrefix(value, `\#`) {
+			value = value[1:]
+		}
+		if strings.HasSuffix(value, "/") {
+			rule.dirOnly = true
+			value = strings.TrimRight(value, "/")
+		}
+
+		// A slash anywhere but the end ties the pattern to the root
+		anchored := strings.Contains(value, "/")
+		value = strings.TrimPrefix(value, "/")
+		if value == "" {
+			return nil, fmt.Errorf("invalid ignore pattern '%s'", pattern)
+		}
+
+		expression := "^"
+		if !anchored {
+			expression += "(?:.*/)?"
+		}
+		expression += globExpression(value) + "$"
+		regex, err := regexp.Compile(expression)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ignore pattern '%s'", pattern)
+		}
+		rule.regex = regex
+		matcher.rules = append(matcher.rules, rule)
+	}
+	return matcher, nil
+}
+
+// Translate a gitignore glob into a regular expression
+func globExpression(glob string) string {
+	var expression strings.Builder
+	for i := 0; i < len(glob); i++ {
+		switch c := glob[i]; c {
+		case '*':
+			if !strings.HasPrefix(glob[i:], "**") {
+				expression.WriteString("[^/]*")
+				continue
+			}
+			atStart := i == 0 || glob[i-1] == '/'
+			i++
+			switch {
+			case atStart && i+1 < len(glob) && glob[i+1] == '/':
+				// "**/" matches any number of folders, including none
+				expression.WriteString("(?:.*/)?")
+				i++
+			case atStart && i+1 == len(glob):
+				// A trailing "/**" matches everything inside
+				expression.WriteString(".*")
+			default:
+				expression.WriteString("[^/]*")
+			}
+		case '?':
+			expression.WriteString("[^/]")
+		case '[':
+			end := strings.IndexByte(glob[i+1:], ']')
+			if end < 0 {
+				expression.WriteString(`\[`)
+				continue
+			}
+			class := glob[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			expression.WriteString("[" + strings.ReplaceAll(class, `\`, `\\`) + "]")
+			i += end + 1
+		case '\\':
+			if i+1 < len(glob) {
+				i++
+				expression.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+			}
+		default:
+			expression.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	return expression.String()
+}
+
+// Get the last rule matching a path, nil if none does
+func (m *IgnoreMatcher) lastMatch(relPath string, isDir bool) *ignoreRule {
+	var last *ignoreRule
+	for i := range m.rules {
+		rule := &m.rules[i]
+		if rule.dirOnly && !isDir {
+			continue
+		}
+		if rule.regex.MatchString(relPath) {
+			last = rule
+		}
+	}
+	return last
+}
+
+// Get the pattern that excludes a file, or "" if the file is installed
+func (m *IgnoreMatcher) excludedBy(relPath string) string {
+	if len(m.rules) == 0 {
+		return ""
+	}
+
+	// An excluded folder takes everything inside it along
+	parts := strings.Split(relPath, "/")
+	for i := 1; i < len(parts); i++ {
+		if rule := m.lastMatch(strings.Join(parts[:i], "/"), true); rule != nil && !rule.negate {
+			return rule.pattern
+		}
+	}
+	if rule := m.lastMatch(relPath, false); rule != nil && !rule.negate {
+		return rule.pattern
+	}
+	return ""
+}
+
+func (m *IgnoreMatcher) ignored(relPath string) bool {
+	return m.excludedBy(relPath) != ""
+}
+
+// Show which files of an addon's cached archive its ignore list, or the
+// patterns given instead, would leave out
+func runIgnoreCommand(args []string) int {
+	fs := flag.NewFlagSet("ignore", flag.ContinueOnError)
+	var dirNames, patterns stringList
+	fs.Var(&dirNames, "dir", "only look at this installation (repeatable)")
+	fs.Var(&patterns, "pattern", "pattern to try instead of the configured ignore list (repeatable)")
+
+	names, err := parseInterspersed(fs, args)
+	if err != nil {
+		return exitUsage
+	}
+	if len(names) != 1 {
+		fmt.Println("Usage: aggon ignore [--dir NAME] [--pattern PATTERN]... <addon>")
+		return exitUsage
+	}
+
+	config, err := loadCommandConfig(dirNames)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return exitUsage
+	}
+	if err := checkAddonNames(config, names); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return exitUsage
+	}
+
+	exitCode := exitOK
+	for _, dir := range config {
+		for _, addon := range applyDirectoryDefaults(dir, filterAddons(dir.Addons, names)) {
+			if len(patterns) > 0 {
+				addon.Ignore = patterns
+			}
+			if err := previewIgnore(dir, addon); err != nil {
+				fmt.Printf("❌ %s (%s) - %v\n", addon.Name, dir.Name, err)
+				exitCode = exitFailure
+			}
+		}
+	}
+	return exitCode
+}
+
+func previewIgnore(dir DirectoryConfig, addon AddonConfig) error {
+	matcher, err := compileIgnorePatterns(addon.Ignore)
+	if err != nil {
+		return err
+	}
+
+	cacheDir := filepath.Join(filepath.Dir(dir.Path), "Aggon", "Cache")
+	cached, exists := loadCacheIndex(cacheDir)[getCacheKey(addon)]
+	if !exists {
+		return fmt.Errorf("no cached archive, install the addon first")
+	}
+	reader, err := zip.OpenReader(filepath.Join(cacheDir, cached.Filename))
+	if err != nil {
+		return fmt.Errorf("failed to open cached archive: %v", err)
+	}
+	defer reader.Close()
+
+	fmt.Printf("📦 %s (%s) - %s\n", addon.Name, dir.Name, cached.Filename)
+	rootFolder := archiveRootFolder(reader.File)
+	total, excluded := 0, 0
+	for _, file := range reader.File {
+		name, err := sanitizeArchivePath(file.Name)
+		if err != nil || file.FileInfo().IsDir() || name == "" || strings.HasPrefix(path.Base(name), ".") {
+			continue
+		}
+		total++
+
+		relativePath := strings.TrimPrefix(name, rootFolder+"/")
+		if pattern := matcher.excludedBy(relativePath); pattern != "" {
+			fmt.Printf("   🚫 %s  (%s)\n", relativePath, pattern)
+			excluded++
+		}
+	}
+	fmt.Printf("   %d of %d files excluded\n\n", excluded, total)
+	return nil
+}
@@ -0,0 +1,391 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Staged installs extract an addon next to the AddOns folder first, check
+// the result and only then move it into place with renames. Every move is
+// recorded in a journal beforehand, so a failed or interrupted swap can put
+// the previous version back.
+
+const swapJournalFile = "journal.json"
+
+// SwapJournal lists what a staged install moves into the AddOns folder
+type SwapJournal struct {
+	Addon string     `json:"addon"`
+	Units []SwapUnit `json:"units"`
+}
+
+// SwapUnit is a folder or single file moved into place as a whole
+type SwapUnit struct {
+	Path    string `json:"path"`             // Relative to the AddOns folder
+	Existed bool   `json:"existed"`          // The previous version was moved aside first
+	Remove  bool   `json:"remove,omitempty"` // Left over from the previous version, only moved aside
+}
+
+// Extract an archive into the staging area, validate it and swap it into the
+// target directory. On failure the target is left as it was.
+func stagedInstall(addon AddonConfig, archivePath, targetDir, stagingRoot string, manifest Manifest) (ManifestEntry, error) {
+	workDir := filepath.Join(stagingRoot, getCacheKey(addon))
+	newDir := filepath.Join(workDir, "new")
+	oldDir := filepath.Join(workDir, "old")
+
+	os.RemoveAll(workDir)
+	if err := os.MkdirAll(newDir, 0755); err != nil {
+		return ManifestEntry{}, fmt.Errorf("failed to create staging directory: %v", err)
+	}
+
+	previous := manifest[addon.Name]
+	entry, err := extractZip(archivePath, newDir, addon)
+	if err == nil {
+		err = validateStagedInstall(addon, entry)
+	}
+	if err == nil {
+		entry, err = carryOverPreserved(addon, entry, previous, targetDir, newDir)
+	}
+	if err != nil {
+		os.RemoveAll(workDir)
+		return entry, err
+	}
+
+	journal := SwapJournal{Addon: addon.Name, Units: swapUnits(addon.Name, entry, previous, targetDir, manifest)}
+	if err := writeSwapJournal(workDir, journal); err != nil {
+		removeStagingDir(workDir)
+		return entry, fmt.Errorf("failed to write swap journal: %v", err)
+	}
+
+	if err := swapIn(journal, newDir, oldDir, targetDir); err != nil {
+		if rollbackErr := rollbackSwap(journal, newDir, oldDir, targetDir); rollbackErr != nil {
+			// Keep the staging directory, the next run retries the rollback
+			return entry, fmt.Errorf("%v; restoring the previous version failed: %v", err, rollbackErr)
+		}
+		removeStagingDir(workDir)
+		return entry, fmt.Errorf("%v, previous version restored", err)
+	}
+
+	removeStagingDir(workDir)
+	return entry, nil
+}
+
+// Remove a staging directory once its swap is done or undone. The journal
+// goes first: a journal left without the staged files would make recovery
+// take everything as moved in and delete the freshly installed folders.
+func removeStagingDir(workDir string) {
+	if err := os.Remove(filepath.Join(workDir, swapJournalFile)); err != nil && !os.IsNotExist(err) {
+		return
+	}
+	os.RemoveAll(workDir)
+}
+
+// Check that a staged addon looks installable: it has a .toc file and the
+// configured folder
+func validateStagedInstall(addon AddonConfig, entry ManifestEntry) error {
+	if len(entry.Files) == 0 {
+		return fmt.Errorf("archive contains no files to install")
+	}
+
+	hasTOC := false
+	for relPath := range entry.Files {
+		if strings.EqualFold(filepath.Ext(relPath), ".toc") {
+			hasTOC = true
+			break
+		}
+	}
+	if !hasTOC {
+		return fmt.Errorf("archive contains no .toc file, it doesn't look like an addon")
+	}
+
+	if addon.Folder != "" {
+		folder := strings.SplitN(filepath.ToSlash(addon.Folder), "/", 2)[0]
+		found := false
+		for _, staged := range entry.Folders {
+			if staged == folder {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("expected folder '%s' is missing from the archive", addon.Folder)
+		}
+	}
+	return nil
+}
+
+// Work out what to move into place. Top-level folders only this addon uses
+// are swapped whole; files in folders shared with other addons and files in
+// the AddOns root are swapped one by one. Whatever the previous version
+// installed that the new one doesn't is moved out, so nothing stale stays.
+func swapUnits(addonName string, entry, previous ManifestEntry, targetDir string, manifest Manifest) []SwapUnit {
+	shared := make(map[string]bool)
+	for name, other := range manifest {
+		if name == addonName {
+			continue
+		}
+		for _, folder := range other.Folders {
+			shared[folder] = true
+		}
+	}
+
+	var paths []string
+	for _, folder := range entry.Folders {
+		if !shared[folder] {
+			paths = append(paths, folder)
+		}
+	}
+	for relPath := range entry.Files {
+		parts := strings.SplitN(relPath, "/", 2)
+		if len(parts) == 1 || shared[parts[0]] {
+			paths = append(paths, relPath)
+		}
+	}
+
+	// Previous folders and files the new version no longer has
+	newFolders := make(map[string]bool)
+	for _, folder := range entry.Folders {
+		newFolders[folder] = true
+	}
+	var stale []string
+	for _, folder := range previous.Folders {
+		if !newFolders[folder] && !shared[folder] {
+			stale = append(stale, folder)
+		}
+	}
+	for relPath := range previous.Files {
+		parts := strings.SplitN(relPath, "/", 2)
+		if _, kept := entry.Files[relPath]; !kept && (len(parts) == 1 || shared[parts[0]]) {
+			stale = append(stale, relPath)
+		}
+	}
+
+	sort.Strings(paths)
+	sort.Strings(stale)
+
+	units := make([]SwapUnit, 0, len(paths)+len(stale))
+	for _, relPath := range paths {
+		_, err := os.Lstat(filepath.Join(targetDir, filepath.FromSlash(relPath)))
+		units = append(units, SwapUnit{Path: relPath, Existed: err == nil})
+	}
+	for _, relPath := range stale {
+		if _, err := os.Lstat(filepath.Join(targetDir, filepath.FromSlash(relPath))); err == nil {
+			units = append(units, SwapUnit{Path: relPath, Existed: true, Remove: true})
+		}
+	}
+	return units
+}
+
+func writeSwapJournal(workDir string, journal SwapJournal) error {
+	data, err := json.MarshalIndent(journal, "", "    ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(workDir, swapJournalFile), data, 0644)
+}
+
+// Move the previous version of each unit aside and the staged one into place
+func swapIn(journal SwapJournal, newDir, oldDir, targetDir string) error {
+	for _, unit := range journal.Units {
+		relPath := filepath.FromSlash(unit.Path)
+		target := filepath.Join(targetDir, relPath)
+
+		if unit.Existed {
+			backup := filepath.Join(oldDir, relPath)
+			if err := os.MkdirAll(filepath.Dir(backup), 0755); err != nil {
+				return fmt.Errorf("failed to move %s aside: %v", unit.Path, err)
+			}
+			if err := os.Rename(target, backup); err != nil {
+				return fmt.Errorf("failed to move %s aside: %v", unit.Path, err)
+			}
+		}
+
+		if unit.Remove {
+			continue
+		}
+
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return fmt.Errorf("failed to move %s into place: %v", unit.Path, err)
+		}
+		if err := os.Rename(filepath.Join(newDir, relPath), target); err != nil {
+			return fmt.Errorf("failed to move %s into place: %v", unit.Path, err)
+		}
+	}
+	return nil
+}
+
+// Undo a partial or complete swap. Units already moved in are taken out
+// again and whatever was moved aside goes back.
+func rollbackSwap(journal SwapJournal, newDir, oldDir, targetDir string) error {
+	var firstErr error
+	for i := len(journal.Units) - 1; i >= 0; i-- {
+		unit := journal.Units[i]
+		relPath := filepath.FromSlash(unit.Path)
+		target := filepath.Join(targetDir, relPath)
+		backup := filepath.Join(oldDir, relPath)
+
+		// The staged copy is gone, so the target holds the new version
+		_, stagedErr := os.Lstat(filepath.Join(newDir, relPath))
+		movedIn := os.IsNotExist(stagedErr) && !unit.Remove
+		_, backupErr := os.Lstat(backup)
+		movedAside := backupErr == nil
+
+		if movedIn && (movedAside || !unit.Existed) {
+			if err := os.RemoveAll(target); err != nil && firstErr == nil {
+				firstErr = err
+			}
+		}
+		if movedAside {
+			if err := os.Rename(backup, target); err != nil && firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	return firstErr
+}
+
+// Check if a path relative to the AddOns folder is marked as preserved,
+// either exactly, as a folder it lives in or by a glob pattern
+func isPreserved(relPath string, preserve []string) bool {
+	for _, pattern := range preserve {
+		pattern = strings.Trim(filepath.ToSlash(pattern), "/")
+		if pattern == "" {
+			continue
+		}
+		if relPath == pattern || strings.HasPrefix(relPath, pattern+"/") {
+			return true
+		}
+		if matched, _ := path.Match(pattern, relPath); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// Copy the installed files marked as preserved into the staged version, so
+// the swap keeps them in place of whatever the archive brought
+func carryOverPreserved(addon AddonConfig, entry, previous ManifestEntry, targetDir, newDir string) (ManifestEntry, error) {
+	if len(addon.Preserve) == 0 {
+		return entry, nil
+	}
+
+	// Files in the AddOns root are only looked at if this addon installed them
+	var candidates []string
+	for relPath := range previous.Files {
+		if !strings.Contains(relPath, "/") {
+			candidates = append(candidates, relPath)
+		}
+	}
+
+	folders := make(map[string]bool)
+	for _, folder := range append(append([]string{}, entry.Folders...), previous.Folders...) {
+		if folders[folder] {
+			continue
+		}
+		folders[folder] = true
+
+		err := filepath.Walk(filepath.Join(targetDir, folder), func(filePath string, info os.FileInfo, err error) error {
+			if err != nil {
+				if os.IsNotExist(err) {
+					return nil
+				}
+				return err
+			}
+			if !info.Mode().IsRegular() {
+				return nil
+			}
+			relPath, err := filepath.Rel(targetDir, filePath)
+			if err != nil {
+				return err
+			}
+			candidates = append(candidates, filepath.ToSlash(relPath))
+			return nil
+		})
+		if err != nil {
+			return entry, fmt.Errorf("failed to read preserved files: %v", err)
+		}
+	}
+
+	for _, relPath := range candidates {
+		if !isPreserved(relPath, addon.Preserve) {
+			continue
+		}
+		source := filepath.Join(targetDir, filepath.FromSlash(relPath))
+		if _, err := os.Stat(source); err != nil {
+			continue
+		}
+		hash, err := copyFileHashed(source, filepath.Join(newDir, filepath.FromSlash(relPath)))
+		if err != nil {
+			return entry, fmt.Errorf("failed to keep preserved file %s: %v", relPath, err)
+		}
+		entry.Files[relPath] = hash
+	}
+
+	entry.Folders = manifestFolders(entry.Files)
+	return entry, nil
+}
+
+// Copy a file, creating its folder, and return the SHA-256 of its contents
+func copyFileHashed(source, dest string) (string, error) {
+	in, err := os.Open(source)
+	if err != nil {
+		return "", err
+	}
+	defer in.Close()
+
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return "", err
+	}
+	out, err := os.Create(dest)
+	if err != nil {
+		return "", err
+	}
+
+	hasher := sha256.New()
+	_, err = io.Copy(io.MultiWriter(out, hasher), in)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
+
+// Put back the previous versions of addons whose install was interrupted
+// mid-swap. Returns the names of the addons restored.
+func recoverInterruptedInstalls(stagingRoot, targetDir string) ([]string, error) {
+	dirs, err := os.ReadDir(stagingRoot)
+	if err != nil {
+		return nil, nil // Nothing staged
+	}
+
+	var restored []string
+	for _, dir := range dirs {
+		workDir := filepath.Join(stagingRoot, dir.Name())
+		data, err := os.ReadFile(filepath.Join(workDir, swapJournalFile))
+		if err != nil {
+			// Interrupted before swapping, the target was never touched
+			os.RemoveAll(workDir)
+			continue
+		}
+
+		var journal SwapJournal
+		if err := json.Unmarshal(data, &journal); err != nil {
+			return restored, fmt.Errorf("unreadable swap journal in %s: %v", workDir, err)
+		}
+		if err := rollbackSwap(journal, filepath.Join(workDir, "new"), filepath.Join(workDir, "old"), targetDir); err != nil {
+			return restored, fmt.Errorf("failed to restore %s: %v", journal.Addon, err)
+		}
+		removeStagingDir(workDir)
+		restored = append(restored, journal.Addon)
+	}
+	return restored, nil
+}
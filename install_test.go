@@ -0,0 +1,140 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// Write files below a root, creating folders as needed
+func writeTree(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// Read every file below a root by its slash-separated relative path
+func readTree(t *testing.T, root string) map[string]string {
+	t.Helper()
+	files := make(map[string]string)
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		relPath, _ := filepath.Rel(root, path)
+		files[filepath.ToSlash(relPath)] = string(data)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+func TestRecoverInterruptedInstalls(t *testing.T) {
+	previous := map[string]string{
+		"MyAddon/MyAddon.toc":                 "old",
+		"MyAddon_Options/MyAddon_Options.toc": "old",
+		"MyAddon_Legacy/MyAddon_Legacy.toc":   "old",
+		"Unrelated/Unrelated.toc":             "untouched",
+	}
+	staged := map[string]string{
+		"MyAddon/MyAddon.toc":                 "new",
+		"MyAddon_Options/MyAddon_Options.toc": "new",
+		"MyAddon_Extras/MyAddon_Extras.toc":   "new",
+	}
+	journal := SwapJournal{Addon: "MyAddon", Units: []SwapUnit{
+		{Path: "MyAddon", Existed: true},
+		{Path: "MyAddon_Extras"},
+		{Path: "MyAddon_Legacy", Existed: true, Remove: true},
+		{Path: "MyAddon_Options", Existed: true},
+	}}
+
+	tests := []struct {
+		name string
+		swap func(t *testing.T, newDir, oldDir, targetDir string)
+	}{
+		{"nothing swapped yet", func(t *testing.T, newDir, oldDir, targetDir string) {}},
+		{"partly swapped", func(t *testing.T, newDir, oldDir, targetDir string) {
+			partial := SwapJournal{Addon: journal.Addon, Units: journal.Units[:3]}
+			if err := swapIn(partial, newDir, oldDir, targetDir); err != nil {
+				t.Fatal(err)
+			}
+			// Interrupted between moving the last folder aside and the new one in
+			os.MkdirAll(oldDir, 0755)
+			if err := os.Rename(filepath.Join(targetDir, "MyAddon_Options"), filepath.Join(oldDir, "MyAddon_Options")); err != nil {
+				t.Fatal(err)
+			}
+		}},
+		{"fully swapped", func(t *testing.T, newDir, oldDir, targetDir string) {
+			if err := swapIn(journal, newDir, oldDir, targetDir); err != nil {
+				t.Fatal(err)
+			}
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			root := t.TempDir()
+			targetDir := filepath.Join(root, "AddOns")
+			stagingRoot := filepath.Join(root, "Staging")
+			workDir := filepath.Join(stagingRoot, "MyAddon-key")
+			newDir := filepath.Join(workDir, "new")
+			oldDir := filepath.Join(workDir, "old")
+
+			writeTree(t, targetDir, previous)
+			writeTree(t, newDir, staged)
+			if err := writeSwapJournal(workDir, journal); err != nil {
+				t.Fatal(err)
+			}
+			test.swap(t, newDir, oldDir, targetDir)
+
+			restored, err := recoverInterruptedInstalls(stagingRoot, targetDir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(restored, []string{"MyAddon"}) {
+				t.Errorf("restored %v", restored)
+			}
+			if got := readTree(t, targetDir); !reflect.DeepEqual(got, previous) {
+				t.Errorf("AddOns holds %v, want the previous version %v", got, previous)
+			}
+			if entries, err := os.ReadDir(stagingRoot); err != nil || len(entries) != 0 {
+				t.Errorf("staging left behind: %v, %v", entries, err)
+			}
+		})
+	}
+}
+
+func TestRecoverWithoutJournal(t *testing.T) {
+	root := t.TempDir()
+	targetDir := filepath.Join(root, "AddOns")
+	stagingRoot := filepath.Join(root, "Staging")
+	previous := map[string]string{"MyAddon/MyAddon.toc": "old"}
+	writeTree(t, targetDir, previous)
+
+	// Interrupted while extracting, before the journal was written
+	writeTree(t, filepath.Join(stagingRoot, "MyAddon-key", "new"), map[string]string{"MyAddon/MyAddon.toc": "new"})
+
+	restored, err := recoverInterruptedInstalls(stagingRoot, targetDir)
+	if err != nil || len(restored) != 0 {
+		t.Fatalf("restored %v, %v", restored, err)
+	}
+	if got := readTree(t, targetDir); !reflect.DeepEqual(got, previous) {
+		t.Errorf("AddOns holds %v, want %v", got, previous)
+	}
+	if entries, _ := os.ReadDir(stagingRoot); len(entries) != 0 {
+		t.Errorf("staging left behind: %v", entries)
+	}
+}
@@ -0,0 +1,278 @@
+package main
+
+import (
+	"archive/zip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// PlannedFile is an archive file and where it goes, relative to the AddOns folder
+type PlannedFile struct {
+	File *zip.File
+	Path string
+}
+
+// Work out which files of an archive an addon installs and where: its ignore
+// list leaves files out, then its paths mappings, its folder or the layout
+// detected from the .toc files place the rest. Entry names must have passed
+// checkArchiveEntries.
+func planArchiveFiles(entries []*zip.File, addon AddonConfig) ([]PlannedFile, error) {
+	ignore, err := compileIgnorePatterns(addon.Ignore)
+	if err != nil {
+		return nil, err
+	}
+	rootFolder := archiveRootFolder(entries)
+
+	// Files to install, by their path in the archive and below its root folder
+	var files []*zip.File
+	var names, relativeNames []string
+	for _, file := range entries {
+		name, _ := sanitizeArchivePath(file.Name)
+		if file.FileInfo().IsDir() || name == "" || strings.HasPrefix(path.Base(name), ".") {
+			continue
+		}
+		relativeName := strings.TrimPrefix(name, rootFolder+"/")
+		if ignore.ignored(relativeName) {
+			continue
+		}
+		files = append(files, file)
+		names = append(names, name)
+		relativeNames = append(relativeNames, relativeName)
+	}
+
+	// Paths mappings pick the folders to install. Without them or a folder
+	// configured, the .toc files tell where the addons are.
+	paths, err := pathsLayout(addon)
+	if err != nil {
+		return nil, err
+	}
+	var detected *ArchiveLayout
+	if paths != nil {
+		if err := paths.checkSources(relativeNames); err != nil {
+			return nil, err
+		}
+	} else if addon.Folder == "" {
+		detected, err = detectArchiveLayout(names)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var planned []PlannedFile
+	for i, file := range files {
+		installPath := path.Join(filepath.ToSlash(addon.Folder), relativeNames[i])
+		inAddon := true
+		if paths != nil {
+			installPath, inAddon = paths.installPath(relativeNames[i])
+		} else if detected != nil {
+			installPath, inAddon = detected.installPath(names[i])
+		}
+		if inAddon {
+			planned = append(planned, PlannedFile{File: file, Path: installPath})
+		}
+	}
+	return planned, nil
+}
+
+// Suffixes of flavor-specific .toc files, like MyAddon_Wrath.toc or MyAddon-Classic.toc
+var tocFlavorSuffixes = []string{"mainline", "classic", "vanilla", "tbc", "bcc", "wrath", "wotlkc", "cata", "mists"}
+
+// ArchiveLayout places the addon folders found in an archive into the AddOns
+// folder, worked out from where its .toc files are
+type ArchiveLayout struct {
+	folders map[string]string // Archive folder, "" for the root, to AddOns folder
+}
+
+// Work out the addon folders of an archive from the paths of its files. A
+// folder holding a .toc is an addon; it keeps its name if that matches the
+// .toc, like ElvUI/ElvUI.toc or Interface/AddOns/ElvUI/ElvUI.toc, and is
+// named after the .toc otherwise, like LFG-main/LFG.toc. A .toc inside
+// another addon folder belongs to an embedded library and is left alone.
+// Returns nil if the archive has no .toc at all.
+func detectArchiveLayout(names []string) (*ArchiveLayout, error) {
+	tocs := make(map[string][]string)
+	for _, name := range names {
+		if strings.EqualFold(path.Ext(name), ".toc") {
+			dir := path.Dir(name)
+			if dir == "." {
+				dir = ""
+			}
+			tocs[dir] = append(tocs[dir], path.Base(name))
+		}
+	}
+	if len(tocs) == 0 {
+		return nil, nil
+	}
+
+	// Shallowest folders first, so embedded libraries are found inside them
+	var dirs []string
+	for dir := range tocs {
+		dirs = append(dirs, dir)
+	}
+	sort.Slice(dirs, func(i, j int) bool {
+		di, dj := folderDepth(dirs[i]), folderDepth(dirs[j])
+		if di != dj {
+			return di < dj
+		}
+		return dirs[i] < dirs[j]
+	})
+
+	layout := &ArchiveLayout{folders: make(map[string]string)}
+	sources := make(map[string]string) // AddOns folder to the archive folder it came from
+	for _, dir := range dirs {
+		if _, nested := layout.installPath(dir + "/"); nested {
+			continue
+		}
+
+		folder := tocAddonName(path.Base(dir), tocs[dir])
+		if source, taken := sources[strings.ToLower(folder)]; taken {
+			return nil, fmt.Errorf("archive has more than one '%s' addon (%s and %s), set folder to pick one", folder, displayFolder(source), displayFolder(dir))
+		}
+		sources[strings.ToLower(folder)] = dir
+		layout.folders[dir] = folder
+	}
+	return layout, nil
+}
+
+// Get where an archive file goes, relative to the AddOns folder. Files
+// outside every addon folder, like a repository's README, aren't installed.
+func (l *ArchiveLayout) installPath(name string) (string, bool) {
+	for source, folder := range l.folders {
+		if source == "" {
+			return path.Join(folder, name), true
+		}
+		if strings.HasPrefix(name, source+"/") {
+			return path.Join(folder, strings.TrimPrefix(name, source+"/")), true
+		}
+	}
+	return "", false
+}
+
+// Get the folder name WoW expects for .toc files found together: the folder's
+// own name if a .toc matches it, otherwise the .toc name without its flavor
+func tocAddonName(folder string, tocFiles []string) string {
+	sort.Strings(tocFiles)
+	names := make([]string, len(tocFiles))
+	for i, tocFile := range tocFiles {
+		names[i] = stripTocFlavor(strings.TrimSuffix(tocFile, path.Ext(tocFile)))
+		if strings.EqualFold(names[i], folder) {
+			return folder
+		}
+	}
+
+	// Prefer a plain MyAddon.toc over the flavored ones
+	for i, tocFile := range tocFiles {
+		if names[i] == strings.TrimSuffix(tocFile, path.Ext(tocFile)) {
+			return names[i]
+		}
+	}
+	return names[0]
+}
+
+func stripTocFlavor(name string) string {
+	lower := strings.ToLower(name)
+	for _, suffix := range tocFlavorSuffixes {
+		for _, separator := range []string{"_", "-"} {
+			if strings.HasSuffix(lower, separator+suffix) {
+				return name[:len(name)-len(separator+suffix)]
+			}
+		}
+	}
+	return name
+}
+
+func folderDepth(dir string) int {
+	if dir == "" {
+		return 0
+	}
+	return strings.Count(dir, "/") + 1
+}
+
+func displayFolder(dir string) string {
+	if dir == "" {
+		return "the archive root"
+	}
+	return dir
+}
+
+// PathMapping installs one folder of an archive as an AddOns folder
+type PathMapping struct {
+	Source string `json:"source"`           // Folder in the archive, below the root folder all files share if any
+	Folder string `json:"folder,omitempty"` // AddOns folder to install it as, the source's name if empty
+}
+
+// Build the layout of an addon's paths mappings, or nil if it has none
+func pathsLayout(addon AddonConfig) (*ArchiveLayout, error) {
+	if len(addon.Paths) == 0 {
+		return nil, nil
+	}
+	if addon.Folder != "" {
+		return nil, fmt.Errorf("set either folder or paths, not both")
+	}
+
+	layout := &ArchiveLayout{folders: make(map[string]string)}
+	sources := make(map[string]string) // AddOns folder to its source
+	for _, mapping := range addon.Paths {
+		source, err := sanitizeArchivePath(mapping.Source)
+		if err != nil {
+			return nil, fmt.Errorf("invalid paths source '%s'", mapping.Source)
+		}
+
+		folder := strings.Trim(filepath.ToSlash(mapping.Folder), "/")
+		if folder == "" {
+			if source == "" {
+				return nil, fmt.Errorf("paths entry for the archive root needs a folder")
+			}
+			folder = path.Base(source)
+		}
+		if strings.Contains(folder, "/") || folder == "." || folder == ".." {
+			return nil, fmt.Errorf("paths folder '%s' must be a single folder name", mapping.Folder)
+		}
+
+		if other, taken := sources[strings.ToLower(folder)]; taken {
+			return nil, fmt.Errorf("paths '%s' and '%s' both install to '%s'", other, mapping.Source, folder)
+		}
+		for other := range layout.folders {
+			if other == "" || source == "" || other == source || strings.HasPrefix(source, other+"/") || strings.HasPrefix(other, source+"/") {
+				return nil, fmt.Errorf("paths '%s' and '%s' overlap", displayFolder(other), displayFolder(source))
+			}
+		}
+		sources[strings.ToLower(folder)] = mapping.Source
+		layout.folders[source] = folder
+	}
+	return layout, nil
+}
+
+// Check that every folder of the layout has files among the given paths
+func (l *ArchiveLayout) checkSources(names []string) error {
+	for source := range l.folders {
+		found := false
+		for _, name := range names {
+			if source == "" || strings.HasPrefix(name, source+"/") {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("paths source '%s' has no files in the archive", source)
+		}
+	}
+	return nil
+}
+
+// Fingerprint of the settings that decide what an archive installs, so
+// changing them re-extracts a cached archive. Empty for the defaults.
+func layoutKey(addon AddonConfig) string {
+	if addon.Folder == "" && len(addon.Ignore) == 0 && len(addon.Paths) == 0 {
+		return ""
+	}
+	data, _ := json.Marshal([]interface{}{addon.Folder, addon.Ignore, addon.Paths})
+	hash := sha256.Sum256(data)
+	return hex.EncodeToString(hash[:])[:16]
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// Build an in-memory archive holding the given files, in order
+func testArchive(t *testing.T, names ...string) []*zip.File {
+	t.Helper()
+	var buffer bytes.Buffer
+	writer := zip.NewWriter(&buffer)
+	for _, name := range names {
+		file, err := writer.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		file.Write([]byte(name))
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	reader, err := zip.NewReader(bytes.NewReader(buffer.Bytes()), int64(buffer.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return reader.File
+}
+
+// Plan an archive for an addon and get the sorted install paths
+func plannedPaths(t *testing.T, entries []*zip.File, addon AddonConfig) []string {
+	t.Helper()
+	planned, err := planArchiveFiles(entries, addon)
+	if err != nil {
+		t.Fatal(err)
+	}
+	paths := []string{}
+	for _, plan := range planned {
+		paths = append(paths, plan.Path)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+func TestArchiveRootFolder(t *testing.T) {
+	tests := []struct {
+		names []string
+		want  string
+	}{
+		{[]string{"Details-main/", "Details-main/Details.toc", "Details-main/Libs/LibStub.lua"}, "Details-main"},
+		{[]string{"Details/Details.toc", "Details_Options/Details_Options.toc"}, ""},
+		{[]string{"Details/Details.toc", "README.md"}, ""},
+		{[]string{"Details.toc", "Core.lua"}, ""},
+	}
+	for _, test := range tests {
+		if got := archiveRootFolder(testArchive(t, test.names...)); got != test.want {
+			t.Errorf("%v: got %q, want %q", test.names, got, test.want)
+		}
+	}
+}
+
+func TestPlanArchiveIgnoreWithWrapperFolder(t *testing.T) {
+	entries := testArchive(t,
+		"Details-main/Details.toc",
+		"Details-main/README.md",
+		"Details-main/Libs/README.md",
+		"Details-main/Core.lua",
+	)
+
+	tests := []struct {
+		ignore []string
+		want   []string
+	}{
+		{nil, []string{"Details/Core.lua", "Details/Details.toc", "Details/Libs/README.md", "Details/README.md"}},
+		{[]string{"/README.md"}, []string{"Details/Core.lua", "Details/Details.toc", "Details/Libs/README.md"}},
+		{[]string{"README.md"}, []string{"Details/Core.lua", "Details/Details.toc"}},
+	}
+	for _, test := range tests {
+		got := plannedPaths(t, entries, AddonConfig{Name: "Details", Ignore: test.ignore})
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("ignore %v: got %v, want %v", test.ignore, got, test.want)
+		}
+	}
+}
+
+func TestPlanArchiveIgnoreWithoutWrapperFolder(t *testing.T) {
+	entries := testArchive(t,
+		"Details/Details.toc",
+		"Details/README.md",
+		"Details_Options/Details_Options.toc",
+		"Details_Options/README.md",
+	)
+
+	tests := []struct {
+		ignore []string
+		want   []string
+	}{
+		{nil, []string{"Details/Details.toc", "Details/README.md", "Details_Options/Details_Options.toc", "Details_Options/README.md"}},
+		{[]string{"/README.md"}, []string{"Details/Details.toc", "Details/README.md", "Details_Options/Details_Options.toc", "Details_Options/README.md"}},
+		{[]string{"/Details/README.md"}, []string{"Details/Details.toc", "Details_Options/Details_Options.toc", "Details_Options/README.md"}},
+		{[]string{"README.md"}, []string{"Details/Details.toc", "Details_Options/Details_Options.toc"}},
+	}
+	for _, test := range tests {
+		got := plannedPaths(t, entries, AddonConfig{Name: "Details", Ignore: test.ignore})
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("ignore %v: got %v, want %v", test.ignore, got, test.want)
+		}
+	}
+}
+
+func TestPlanArchivePathsWithoutWrapperFolder(t *testing.T) {
+	entries := testArchive(t,
+		"Details/Details.toc",
+		"Details/Core.lua",
+		"Details_Options/Details_Options.toc",
+		"README.md",
+	)
+
+	addon := AddonConfig{Name: "Details", Paths: []PathMapping{
+		{Source: "Details"},
+		{Source: "Details_Options", Folder: "DetailsOptions"},
+	}}
+	got := plannedPaths(t, entries, addon)
+	want := []string{"Details/Core.lua", "Details/Details.toc", "DetailsOptions/Details_Options.toc"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
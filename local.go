@@ -0,0 +1,155 @@
+package main
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+const localSourcePrefix = "file://"
+
+// Matches the slash before a drive letter in file:///C:/... URLs
+var driveLetterPath = regexp.MustCompile(`^/[A-Za-z]:`)
+
+// Check if an addon URL points at a zip file or directory on disk
+func isLocalSource(sourceURL string) bool {
+	return strings.HasPrefix(strings.ToLower(sourceURL), localSourcePrefix)
+}
+
+// Turn a file:// URL into a path. Accepts file:///C:/Addons, file://C:/Addons,
+// file://localhost/C:/Addons and relative file://./Addons; any other host
+// names a file share, so file://server/share/addon.zip is \\server\share\addon.zip.
+func localSourcePath(sourceURL string) string {
+	path := sourceURL[len(localSourcePrefix):]
+	if unescaped, err := url.PathUnescape(path); err == nil {
+		path = unescaped
+	}
+
+	if !strings.HasPrefix(path, "/") {
+		host, rest, _ := strings.Cut(path, "/")
+		switch {
+		case strings.EqualFold(host, "localhost"):
+			path = "/" + rest
+		case host == "." || host == ".." || driveLetterPrefix.MatchString(host):
+			// Relative or drive letter paths, kept as they are
+		default:
+			path = "//" + path
+		}
+	}
+
+	if driveLetterPath.MatchString(path) {
+		path = path[1:]
+	}
+	return filepath.FromSlash(path)
+}
+
+// Returned by openArchiveSource when a conditional download found no changes
+var errNotModified = errors.New("not modified")
+
+// Open the archive behind a download URL, returning the response headers of
+// downloads. Local zips are read as they are and local directories are zipped
+// on the fly under a root folder named after the directory, the same layout
+// GitHub archives have.
+func openArchiveSource(downloadURL string, headers map[string]string) (io.ReadCloser, http.Header, error) {
+	if !isLocalSource(downloadURL) {
+		req, err := http.NewRequest(http.MethodGet, downloadURL, nil)
+		if err != nil {
+			return nil, nil, err
+		}
+		for key, value := range headers {
+			req.Header.Set(key, value)
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to download: %v", err)
+		}
+		if resp.StatusCode == http.StatusNotModified {
+			resp.Body.Close()
+			return nil, nil, errNotModified
+		}
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			return nil, nil, fmt.Errorf("download failed with status: %s", resp.Status)
+		}
+		return resp.Body, resp.Header, nil
+	}
+
+	path := localSourcePath(downloadURL)
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open local source: %v", err)
+	}
+	if !info.IsDir() {
+		file, err := os.Open(path)
+		return file, http.Header{}, err
+	}
+
+	reader, writer := io.Pipe()
+	go func() {
+		writer.CloseWithError(zipDirectory(writer, path))
+	}()
+	return reader, http.Header{}, nil
+}
+
+// Zip a directory. Only names and contents are stored, so the archive hash
+// changes exactly when the files do.
+func zipDirectory(w io.Writer, root string) error {
+	zipWriter := zip.NewWriter(w)
+	rootName := filepath.Base(root)
+
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		// Repository metadata isn't part of the addon, neither the .git
+		// folder nor the .git files submodules have instead
+		if info.Name() == ".git" && path != root {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if info.IsDir() {
+			return nil
+		}
+
+		relPath, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+
+		// Following a symlink could pack files from anywhere on the machine
+		if info.Mode()&os.ModeSymlink != 0 {
+			return fmt.Errorf("'%s' is a symlink", filepath.ToSlash(relPath))
+		}
+
+		writer, err := zipWriter.CreateHeader(&zip.FileHeader{
+			Name:   rootName + "/" + filepath.ToSlash(relPath),
+			Method: zip.Deflate,
+		})
+		if err != nil {
+			return err
+		}
+
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		_, err = io.Copy(writer, file)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return zipWriter.Close()
+}
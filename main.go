@@ -6,49 +6,97 @@ import (
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"net/http"
 	"os"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
 type AddonConfig struct {
-	Disabled      bool     `json:"disabled,omitempty"`
-	Name          string   `json:"name"`
-	URL           string   `json:"url"`
-	Folder        string   `json:"folder,omitempty"`
-	Ignore        []string `json:"ignore,omitempty"`
-	Branch        string   `json:"branch,omitempty"`
-	Tag           string   `json:"tag,omitempty"`
-	LatestRelease bool     `json:"latest_release,omitempty"`
-	AssetPattern  string   `json:"asset_pattern,omitempty"`
+	Disabled      bool          `json:"disabled,omitempty"`
+	Name          string        `json:"name"`
+	URL           string        `json:"url"`
+	Provider      string        `json:"provider,omitempty"`     // github, gitlab, gitea, curseforge, wago or wowinterface; detected from the URL if empty
+	BaseURL       string        `json:"base_url,omitempty"`     // Root of a self-hosted server living under a sub-path
+	ProjectID     string        `json:"project_id,omitempty"`   // Addon site project, if the URL doesn't identify it
+	Flavor        string        `json:"flavor,omitempty"`       // Game flavor to pick addon site files for
+	ReleaseType   string        `json:"release_type,omitempty"` // release, beta or alpha on addon sites
+	APIKey        string        `json:"-"`                      // Filled from the installation's api_keys or the environment
+	Folder        string        `json:"folder,omitempty"`
+	Paths         []PathMapping `json:"paths,omitempty"` // Archive folders to install, each as its own AddOns folder
+	Ignore        []string      `json:"ignore,omitempty"`
+	Preserve      []string      `json:"preserve,omitempty"` // Paths in AddOns to keep across updates, e.g. "MyAddon/Custom" or "MyAddon/*.cfg"
+	Branch        string        `json:"branch,omitempty"`
+	Tag           string        `json:"tag,omitempty"`
+	Version       string        `json:"version,omitempty"`     // Semver constraint on tags, e.g. ^1.15, ~2.3 or >=1.0 <2.0
+	TagPattern    string        `json:"tag_pattern,omitempty"` // Regex tags must match, the first group holds the version
+	LatestRelease bool          `json:"latest_release,omitempty"`
+	Channel       string        `json:"channel,omitempty"` // stable, beta or alpha; which releases and tags may be installed
+	AssetPattern  string        `json:"asset_pattern,omitempty"`
+	SHA256        string        `json:"sha256,omitempty"`      // Expected SHA-256 of the downloaded archive
+	SigningKey    string        `json:"signing_key,omitempty"` // minisign public key, or path to a minisign or OpenPGP key file
+	Git           bool          `json:"git,omitempty"`         // Clone with git instead of downloading archives
+	Commit        string        `json:"commit,omitempty"`      // Commit SHA to pin a git source to
+
+	// Filled from the installation's extraction limits
+	Limits ExtractLimits `json:"-"`
 }
 
 type DirectoryConfig struct {
-	Name            string        `json:"name"`
-	Path            string        `json:"path"`
-	Addons          []AddonConfig `json:"addons"`
-	BackupBlacklist []string      `json:"backup_blacklist,omitempty"`
+	Name               string            `json:"name"`
+	Path               string            `json:"path"`
+	Addons             []AddonConfig     `json:"addons"`
+	BackupBlacklist    []string          `json:"backup_blacklist,omitempty"`
+	WTFBlacklist       []string          `json:"wtf_blacklist,omitempty"`
+	BackupFormat       string            `json:"backup_format,omitempty"`
+	StrictDependencies bool              `json:"strict_dependencies,omitempty"`
+	Concurrency        int               `json:"concurrency,omitempty"`
+	Retention          *RetentionPolicy  `json:"retention,omitempty"`
+	Flavor             string            `json:"flavor,omitempty"`              // Default game flavor for addon site sources
+	Channel            string            `json:"channel,omitempty"`             // Default release channel for addons
+	MaxExtractSizeMB   int               `json:"max_extract_size_mb,omitempty"` // Largest total size one archive may unpack to
+	MaxExtractFiles    int               `json:"max_extract_files,omitempty"`   // Most files one archive may contain
+	APIKeys            map[string]string `json:"api_keys,omitempty"`            // API keys by provider, e.g. "curseforge"
 }
 
 type Config []DirectoryConfig
 
+// InstallOptions controls how installAllAddons treats addons
+type InstallOptions struct {
+	Force       bool     // Uninstall disabled addons even if enabled addons still depend on them
+	Refresh     bool     // Download archives again instead of asking whether they changed
+	Concurrency int      // Overrides the per-installation download concurrency when set
+	Addons      []string // Only process these addons (all when empty)
+}
+
+// Number of addons resolved and downloaded at once when not configured
+const defaultConcurrency = 4
+
 type CacheEntry struct {
-	URL          string    `json:"url"`
-	Hash         string    `json:"hash"`
-	LastModified time.Time `json:"last_modified"`
-	Filename     string    `json:"filename"`
+	URL                  string    `json:"url"`
+	Hash                 string    `json:"hash"`
+	LastModified         time.Time `json:"last_modified"` // When the source was last checked
+	Filename             string    `json:"filename"`
+	Commit               string    `json:"commit,omitempty"`             // Resolved commit of git sources
+	ETag                 string    `json:"etag,omitempty"`               // Validators the server sent with the archive,
+	HTTPLastModified     string    `json:"http_last_modified,omitempty"` // used to make the next download conditional
+	DefaultBranch        string    `json:"default_branch,omitempty"`     // Resolved default branch of the repository
+	DefaultBranchChecked time.Time `json:"default_branch_checked"`       // When the default branch was last looked up
 }
 
 type CacheIndex map[string]CacheEntry
 
 type GitHubRelease struct {
-	TagName string `json:"tag_name"`
-	Assets  []struct {
+	TagName    string `json:"tag_name"`
+	Draft      bool   `json:"draft"`
+	Prerelease bool   `json:"prerelease"`
+	Assets     []struct {
 		Name               string `json:"name"`
 		BrowserDownloadURL string `json:"browser_download_url"`
 	} `json:"assets"`
@@ -72,6 +120,18 @@ func main() {
 				}
 				return
 			}
+		case "install", "update", "list", "remove", "enable", "disable", "backup", "restore", "prune", "export", "ignore":
+			os.Exit(runCommand(os.Args[1], os.Args[2:]))
+		case "info":
+			if len(os.Args) < 3 {
+				fmt.Println("Usage: aggon info <addon>")
+				os.Exit(1)
+			}
+			if err := runInfo(strings.Join(os.Args[2:], " ")); err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(1)
+			}
+			return
 		case "format-config":
 			if err := formatConfig(); err != nil {
 				fmt.Printf("Error: %v\n", err)
@@ -110,7 +170,9 @@ func runMainMenu() {
 		switch choice {
 		case "1":
 			if len(config) > 0 {
-				installAllAddons(config)
+				printBanner()
+				installAllAddons(config, InstallOptions{})
+				waitForEnter()
 			} else {
 				fmt.Println("⚠ No installation paths configured. Use option 3 first.")
 				waitForEnter()
@@ -126,7 +188,9 @@ func runMainMenu() {
 				waitForEnter()
 			}
 		case "4":
+			printBanner()
 			backupAllAddons(config)
+			waitForEnter()
 		case "5":
 			if err := formatConfig(); err != nil {
 				fmt.Printf("Error: %v\n", err)
@@ -134,6 +198,12 @@ func runMainMenu() {
 				fmt.Println("✨ Config formatted successfully!")
 			}
 			waitForEnter()
+		case "6":
+			printBanner()
+			if err := runRestoreWizard(config); err != nil {
+				fmt.Printf("Error: %v\n", err)
+			}
+			waitForEnter()
 		case "q", "quit", "exit":
 			fmt.Println("Goodbye!")
 			return
@@ -179,6 +249,7 @@ func displayMenu(config Config) {
 	fmt.Println("3. 📁 Add Installation Path")
 	fmt.Println("4. 💾 Backup All Addon Directories")
 	fmt.Println("5. ✨ Format Config File")
+	fmt.Println("6. ♻️  Restore From Backup")
 	fmt.Println("q. Quit")
 	fmt.Println()
 }
@@ -195,23 +266,36 @@ func handleConfigError(err error) {
 	createSampleConfig()
 
 	fmt.Println("✅ Sample config.json created!")
-	fmt.Println("Please edit it with your addon directories and GitHub URLs, then restart.")
+	fmt.Println("Please edit it with your addon directories and repository URLs, then restart.")
 	fmt.Println()
 	fmt.Println("Press Enter to exit...")
 	bufio.NewReader(os.Stdin).ReadString('\n')
 }
 
-func installAllAddons(config Config) {
+// Clear the screen and print the banner for menu actions
+func printBanner() {
 	fmt.Print("\033[H\033[2J") // Clear screen
 
 	fmt.Println("🏺 AGGON")
 	fmt.Println("========")
 	fmt.Println()
+}
+
+// InstallSummary counts the outcome of an installAllAddons run
+type InstallSummary struct {
+	Successful int
+	Cached     int
+	Failed     int
+	Disabled   int
+	DirErrors  int // Installations that could not be processed at all
+}
+
+func installAllAddons(config Config, opts InstallOptions) InstallSummary {
 	fmt.Println("🚀 Installing/Updating Addons")
 	fmt.Println("=============================")
 	fmt.Println()
 
-	var successful, failed, disabled, cached int
+	var successful, failed, disabled, cached, dirErrors int
 
 	for _, dir := range config {
 		fmt.Printf("📂 %s\n", dir.Name)
@@ -221,6 +305,7 @@ func installAllAddons(config Config) {
 		// Create directory if it doesn't exist
 		if err := os.MkdirAll(dir.Path, 0755); err != nil {
 			fmt.Printf("   ❌ Failed to create directory: %v\n", err)
+			dirErrors++
 			continue
 		}
 
@@ -231,16 +316,69 @@ func installAllAddons(config Config) {
 
 		if err := setupAggonDirectories(aggonDir, cacheDir, backupDir); err != nil {
 			fmt.Printf("   ❌ Failed to setup Aggon directories: %v\n", err)
+			dirErrors++
 			continue
 		}
 
-		// Load cache index
+		// Load cache index and install manifest
 		cacheIndex := loadCacheIndex(cacheDir)
+		manifest := loadManifest(aggonDir)
+
+		// Finish rolling back installs a previous run was interrupted in
+		restored, err := recoverInterruptedInstalls(filepath.Join(aggonDir, "Staging"), dir.Path)
+		for _, name := range restored {
+			fmt.Printf("   ♻️  %s - Restored previous version after an interrupted install\n", name)
+		}
+		if err != nil {
+			fmt.Printf("   ❌ Failed to recover interrupted install: %v\n", err)
+			dirErrors++
+			continue
+		}
+
+		// Resolve and download enabled addons concurrently
+		selected := dir.Addons
+		if len(opts.Addons) > 0 {
+			selected = filterAddons(selected, opts.Addons)
+		}
+		var toFetch []AddonConfig
+		for _, addon := range applyDirectoryDefaults(dir, selected) {
+			if !addon.Disabled {
+				toFetch = append(toFetch, addon)
+			}
+		}
+		fetched := fetchAddonArchives(toFetch, cacheDir, cacheIndex, installConcurrency(dir, opts), opts.Refresh)
+
+		// Record fetched archives so change detection sees the latest versions,
+		// and read what each would install for the dependency check
+		upcoming := make(map[string]ArchiveContents)
+		for _, addon := range toFetch {
+			result := fetched[addon.Name]
+			if result.Err != nil {
+				continue
+			}
+			cacheIndex[getCacheKey(addon)] = result.Archive.Entry
+			if contents, err := readArchiveContents(result.Archive.Path, addon); err == nil {
+				upcoming[addon.Name] = contents
+			}
+		}
+
+		// Resolve dependencies between configured addons as they will be
+		// once the fetched archives are installed
+		graph := buildDependencyGraph(dir, manifest, upcoming)
+		depProblems := checkDependencies(dir, graph)
+		addons, cycle := orderAddonsByDependencies(graph)
+		if len(cycle) > 0 {
+			fmt.Printf("   ⚠️  Dependency cycle between: %s\n", strings.Join(cycle, ", "))
+		}
+		if len(opts.Addons) > 0 {
+			addons = filterAddons(addons, opts.Addons)
+		}
+		addons = applyDirectoryDefaults(dir, addons)
 
 		// Check which addons will actually need changes
 		changesNeeded := false
-		for _, addon := range dir.Addons {
-			if willAddonChange(addon, dir.Path, cacheDir, cacheIndex) {
+		for _, addon := range addons {
+			if willAddonChange(addon, dir.Path, cacheDir, cacheIndex, manifest) {
 				changesNeeded = true
 				break
 			}
@@ -249,22 +387,32 @@ func installAllAddons(config Config) {
 		// Create backup only if changes are needed
 		if changesNeeded {
 			fmt.Printf("   💾 Changes detected - creating backup before installation...\n")
-			if err := backupFullDirectory(dir, backupDir); err != nil {
+			decisions, err := backupFullDirectory(dir, backupDir)
+			if err != nil {
 				fmt.Printf("   ⚠️  Pre-installation backup failed: %v\n", err)
 			} else {
 				fmt.Printf("   ✅ Pre-installation backup created\n")
 			}
+			printPruneDecisions(decisions, "   ", false)
 		} else {
 			fmt.Printf("   ℹ️  No changes needed - skipping backup\n")
 		}
 
-		// Process each addon
-		for _, addon := range dir.Addons {
+		// Process each addon, dependencies first. Extraction stays sequential
+		// so only one addon writes into the directory at a time.
+		for _, addon := range addons {
 			if addon.Disabled {
 				// Check if addon is currently installed before trying to uninstall
-				if addonExists(addon, dir.Path) {
+				if addonExists(addon, dir.Path, manifest) {
+					// Keep addons that enabled addons still depend on
+					if dependents := findDependents(graph, addon); len(dependents) > 0 && !opts.Force {
+						fmt.Printf("   ⛔ %s - Not uninstalled, still required by %s\n", addon.Name, strings.Join(dependents, ", "))
+						failed++
+						continue
+					}
+
 					fmt.Printf("   🗑️  %s - Uninstalling...", addon.Name)
-					if err := uninstallAddon(addon, dir.Path); err != nil {
+					if err := uninstallAddon(addon, dir.Path, manifest); err != nil {
 						fmt.Print("\r\033[K")
 						fmt.Printf("   ❌ %s - Uninstall Error: %v\n", addon.Name, err)
 						failed++
@@ -278,27 +426,48 @@ func installAllAddons(config Config) {
 					disabled++
 				}
 			} else {
-									fmt.Printf("   ⏳ %s - Checking for updates...", addon.Name)
-				fromCache, err := installAddonWithCache(addon, dir.Path, cacheDir, cacheIndex)
+				if problems := depProblems[addon.Name]; len(problems) > 0 {
+					if dir.StrictDependencies {
+						fmt.Printf("   ❌ %s - Dependency Error: %s\n", addon.Name, strings.Join(problems, "; "))
+						failed++
+						continue
+					}
+					for _, problem := range problems {
+						fmt.Printf("   ⚠️  %s - %s\n", addon.Name, problem)
+					}
+				}
+
+				fmt.Printf("   ⏳ %s - Installing...", addon.Name)
+				result := fetched[addon.Name]
+				fromCache, err := result.Archive.FromCache, result.Err
+				if err == nil {
+					fromCache, err = installFetchedArchive(addon, result.Archive, dir.Path, cacheDir, cacheIndex, manifest)
+				}
 				// Clear the line completely
 				fmt.Print("\r\033[K")
+				if result.Archive.Stale != "" {
+					fmt.Printf("   ⚠️  %s - %s, using cached version\n", addon.Name, result.Archive.Stale)
+				}
 				if err != nil {
 					fmt.Printf("   ❌ %s - Error: %v\n", addon.Name, err)
 					failed++
 				} else {
+					version := installedVersion(addon, dir.Path, manifest)
 					if fromCache {
-						fmt.Printf("   ✅ %s - Up to date (from cache)\n", addon.Name)
+						fmt.Printf("   ✅ %s - Up to date (from cache)%s\n", addon.Name, formatVersionSuffix(version))
 						cached++
 					} else {
-						fmt.Printf("   ✅ %s - Updated successfully\n", addon.Name)
+						fmt.Printf("   ✅ %s - Updated successfully%s\n", addon.Name, formatVersionSuffix(version))
 						successful++
 					}
 				}
 			}
 		}
 
-		// Save cache index
+		// Save cache index and install manifest
 		saveCacheIndex(cacheDir, cacheIndex)
+		cleanupGitClones(cacheDir, cacheIndex)
+		saveManifest(aggonDir, manifest)
 		fmt.Println()
 	}
 
@@ -313,20 +482,120 @@ func installAllAddons(config Config) {
 	if disabled > 0 {
 		fmt.Printf("🗑️  %d addons uninstalled (disabled)\n", disabled)
 	}
+	if dirErrors > 0 {
+		fmt.Printf("❌ %d installations failed\n", dirErrors)
+	}
 	fmt.Println()
 
-	waitForEnter()
+	return InstallSummary{
+		Successful: successful,
+		Cached:     cached,
+		Failed:     failed,
+		Disabled:   disabled,
+		DirErrors:  dirErrors,
+	}
+}
+
+// Keep only the named addons, matched case-insensitively, in their given order
+func filterAddons(addons []AddonConfig, names []string) []AddonConfig {
+	var filtered []AddonConfig
+	for _, addon := range addons {
+		for _, name := range names {
+			if strings.EqualFold(addon.Name, name) {
+				filtered = append(filtered, addon)
+				break
+			}
+		}
+	}
+	return filtered
+}
+
+// Fill in settings addons inherit from their installation
+func applyDirectoryDefaults(dir DirectoryConfig, addons []AddonConfig) []AddonConfig {
+	resolved := make([]AddonConfig, len(addons))
+	for i, addon := range addons {
+		if addon.Flavor == "" {
+			addon.Flavor = dir.Flavor
+		}
+		if addon.Channel == "" {
+			addon.Channel = dir.Channel
+		}
+		addon.APIKey = providerAPIKey(dir, addonProvider(addon))
+		addon.Limits = extractLimits(dir)
+		resolved[i] = addon
+	}
+	return resolved
+}
+
+func installConcurrency(dir DirectoryConfig, opts InstallOptions) int {
+	if opts.Concurrency > 0 {
+		return opts.Concurrency
+	}
+	if dir.Concurrency > 0 {
+		return dir.Concurrency
+	}
+	return defaultConcurrency
+}
+
+type fetchResult struct {
+	Archive FetchedArchive
+	Err     error
+}
+
+// Resolve and download addons with a bounded worker pool, keyed by addon name
+func fetchAddonArchives(addons []AddonConfig, cacheDir string, cacheIndex CacheIndex, concurrency int, refresh bool) map[string]fetchResult {
+	results := make(map[string]fetchResult, len(addons))
+	if len(addons) == 0 {
+		return results
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	jobs := make(chan AddonConfig)
+	done := 0
+
+	printProgress := func() {
+		fmt.Printf("\r\033[K   ⏳ Checking for updates... (%d/%d)", done, len(addons))
+	}
+	printProgress()
+
+	for i := 0; i < concurrency && i < len(addons); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for addon := range jobs {
+				archive, err := fetchAddonArchive(addon, cacheDir, cacheIndex, refresh)
+
+				mu.Lock()
+				results[addon.Name] = fetchResult{Archive: archive, Err: err}
+				done++
+				printProgress()
+				mu.Unlock()
+			}
+		}()
+	}
+
+	for _, addon := range addons {
+		jobs <- addon
+	}
+	close(jobs)
+	wg.Wait()
+
+	// Clear the progress line
+	fmt.Print("\r\033[K")
+	return results
 }
 
 // New function to determine if an addon will actually change
-func willAddonChange(addon AddonConfig, targetDir, cacheDir string, cacheIndex CacheIndex) bool {
+func willAddonChange(addon AddonConfig, targetDir, cacheDir string, cacheIndex CacheIndex, manifest Manifest) bool {
 	// If addon is disabled and currently exists, it will be uninstalled (change)
 	if addon.Disabled {
-		return addonExists(addon, targetDir)
+		return addonExists(addon, targetDir, manifest)
 	}
 
-	// If addon doesn't exist, it will be installed (change)
-	if !addonExists(addon, targetDir) {
+	// If addon isn't fully installed from its configured source, it will be installed (change)
+	installed, exists := manifest[addon.Name]
+	if !exists || installed.URL != addon.URL || !installed.isIntact(targetDir) {
 		return true
 	}
 
@@ -343,14 +612,9 @@ func willAddonChange(addon AddonConfig, targetDir, cacheDir string, cacheIndex C
 		return true // Cache file missing, will download (change)
 	}
 
-	// Check if cache is expired and we need to check for updates
-	if addon.LatestRelease {
-		// For latest releases, check if cache is older than 1 hour
-		return time.Since(entry.LastModified) > time.Hour
-	} else {
-		// For fixed versions, check if cache is older than 24 hours
-		return time.Since(entry.LastModified) > 24*time.Hour
-	}
+	// The cache was just checked against the source, so the addon changes
+	// exactly when the installed files didn't come from the cached archive
+	return installed.ArchiveHash != entry.Hash
 }
 
 func runAddAddonWizard() error {
@@ -391,40 +655,106 @@ func runAddAddonWizard() error {
 		return fmt.Errorf("addon name is required")
 	}
 
-	fmt.Print("GitHub URL: ")
-	githubURL, _ := reader.ReadString('\n')
-	githubURL = strings.TrimSpace(githubURL)
-	if !strings.Contains(githubURL, "github.com") {
-		return fmt.Errorf("must be a valid GitHub URL")
+	fmt.Print("Addon URL (GitHub, GitLab, Codeberg/Gitea/Forgejo, CurseForge, Wago, WoWInterface or file://): ")
+	repoURL, _ := reader.ReadString('\n')
+	repoURL = strings.TrimSpace(repoURL)
+
+	// Self-hosted servers the host name doesn't give away need their provider
+	var provider, baseURL string
+	isLocal := isLocalSource(repoURL)
+	if !isLocal && detectProvider(repoURL) == "" {
+		fmt.Print("Provider (github, gitlab, gitea/forgejo): ")
+		provider, _ = reader.ReadString('\n')
+		provider = strings.TrimSpace(provider)
+
+		fmt.Print("Server Base URL (optional, if it lives under a sub-path): ")
+		baseURL, _ = reader.ReadString('\n')
+		baseURL = strings.TrimSpace(baseURL)
+	}
+	_, isSite := addonSiteFor(AddonConfig{URL: repoURL, Provider: provider})
+	if isLocal {
+		if _, err := os.Stat(localSourcePath(repoURL)); err != nil {
+			return fmt.Errorf("local source not found: %v", err)
+		}
+	} else if !isSite {
+		if _, err := sourceProviderFor(AddonConfig{URL: repoURL, Provider: provider, BaseURL: baseURL}); err != nil {
+			return fmt.Errorf("must be a valid repository URL: %v", err)
+		}
 	}
 
-	fmt.Print("Custom Folder Name (optional, press Enter to skip): ")
+	fmt.Print("Custom Folder Name (optional, press Enter to detect from the .toc files): ")
 	folder, _ := reader.ReadString('\n')
 	folder = strings.TrimSpace(folder)
 
-	fmt.Print("Ignore Files (comma-separated, optional): ")
+	fmt.Print("Ignore Patterns (comma-separated, .gitignore style, optional): ")
 	ignoreInput, _ := reader.ReadString('\n')
 	ignoreInput = strings.TrimSpace(ignoreInput)
 
-	fmt.Print("Use Latest Release? (y/N): ")
-	releaseInput, _ := reader.ReadString('\n')
-	latestRelease := strings.ToLower(strings.TrimSpace(releaseInput)) == "y"
+	var latestRelease bool
+	var assetPattern, tag, version, channel, branch, commit, releaseType string
+
+	switch {
+	case isLocal:
+		// Local zips and directories are installed as they are
+	case isSite:
+		// Addon sites always serve their newest file
+		fmt.Print("Release Type (release/beta/alpha, press Enter for release): ")
+		releaseType, _ = reader.ReadString('\n')
+		releaseType = strings.ToLower(strings.TrimSpace(releaseType))
+		if _, err := parseReleaseType(releaseType); err != nil {
+			return err
+		}
+	default:
+		fmt.Print("Use Latest Release? (y/N): ")
+		releaseInput, _ := reader.ReadString('\n')
+		latestRelease = strings.ToLower(strings.TrimSpace(releaseInput)) == "y"
+
+		readVersion := func() error {
+			fmt.Print("Version Constraint (optional, e.g. ^1.15 or >=1.0 <2.0): ")
+			version, _ = reader.ReadString('\n')
+			version = strings.TrimSpace(version)
+			if version == "" {
+				return nil
+			}
+			_, err := parseConstraint(version)
+			return err
+		}
+
+		if latestRelease {
+			if err := readVersion(); err != nil {
+				return err
+			}
 
-	var assetPattern, tag, branch string
+			fmt.Print("Release Channel (stable/beta/alpha, press Enter for the installation default): ")
+			channel, _ = reader.ReadString('\n')
+			channel = strings.ToLower(strings.TrimSpace(channel))
+			if _, err := parseChannel(channel); err != nil {
+				return err
+			}
 
-	if latestRelease {
-		fmt.Print("Asset Pattern (optional, for multiple release assets): ")
-		assetPattern, _ = reader.ReadString('\n')
-		assetPattern = strings.TrimSpace(assetPattern)
-	} else {
-		fmt.Print("Specific Tag (optional, press Enter to skip): ")
-		tag, _ = reader.ReadString('\n')
-		tag = strings.TrimSpace(tag)
+			fmt.Print("Asset Pattern (optional, for multiple release assets): ")
+			assetPattern, _ = reader.ReadString('\n')
+			assetPattern = strings.TrimSpace(assetPattern)
+		} else {
+			fmt.Print("Specific Tag (optional, press Enter to skip): ")
+			tag, _ = reader.ReadString('\n')
+			tag = strings.TrimSpace(tag)
+
+			if tag == "" {
+				if err := readVersion(); err != nil {
+					return err
+				}
+			}
+
+			if tag == "" && version == "" {
+				fmt.Print("Specific Branch (optional, press Enter for default): ")
+				branch, _ = reader.ReadString('\n')
+				branch = strings.TrimSpace(branch)
 
-		if tag == "" {
-			fmt.Print("Specific Branch (optional, press Enter for default): ")
-			branch, _ = reader.ReadString('\n')
-			branch = strings.TrimSpace(branch)
+				fmt.Print("Pin to Commit SHA (optional, clones with git): ")
+				commit, _ = reader.ReadString('\n')
+				commit = strings.TrimSpace(commit)
+			}
 		}
 	}
 
@@ -438,8 +768,10 @@ func runAddAddonWizard() error {
 
 	// Create new addon
 	newAddon := AddonConfig{
-		Name: addonName,
-		URL:  githubURL,
+		Name:     addonName,
+		URL:      repoURL,
+		Provider: provider,
+		BaseURL:  baseURL,
 	}
 
 	if len(ignoreFiles) > 0 {
@@ -457,9 +789,21 @@ func runAddAddonWizard() error {
 	if tag != "" {
 		newAddon.Tag = tag
 	}
+	if version != "" {
+		newAddon.Version = version
+	}
+	if channel != "" {
+		newAddon.Channel = channel
+	}
 	if branch != "" {
 		newAddon.Branch = branch
 	}
+	if commit != "" {
+		newAddon.Commit = commit
+	}
+	if releaseType != "" && releaseType != "release" {
+		newAddon.ReleaseType = releaseType
+	}
 
 	// Add to config
 	config[selectedDirIndex].Addons = append(config[selectedDirIndex].Addons, newAddon)
@@ -473,18 +817,11 @@ func runAddAddonWizard() error {
 	return nil
 }
 
-func backupAllAddons(config Config) {
-	fmt.Print("\033[H\033[2J") // Clear screen
-
-	fmt.Println("🏺 AGGON")
-	fmt.Println("========")
-	fmt.Println()
+func backupAllAddons(config Config) (successful, failed int) {
 	fmt.Println("💾 Backing Up All Addon Directories")
 	fmt.Println("===================================")
 	fmt.Println()
 
-	var successful, failed int
-
 	for _, dir := range config {
 		fmt.Printf("📂 %s\n", dir.Name)
 		fmt.Printf("   %s\n", dir.Path)
@@ -507,13 +844,15 @@ func backupAllAddons(config Config) {
 		}
 
 		fmt.Printf("   💾 Creating full directory backup...\n")
-		if err := backupFullDirectory(dir, backupDir); err != nil {
+		decisions, err := backupFullDirectory(dir, backupDir)
+		if err != nil {
 			fmt.Printf("   ❌ Backup failed: %v\n", err)
 			failed++
 		} else {
 			fmt.Printf("   ✅ Backup completed successfully\n")
 			successful++
 		}
+		printPruneDecisions(decisions, "   ", false)
 		fmt.Println()
 	}
 
@@ -526,7 +865,7 @@ func backupAllAddons(config Config) {
 	}
 	fmt.Println()
 
-	waitForEnter()
+	return successful, failed
 }
 
 func setupAggonDirectories(dirs ...string) error {
@@ -573,111 +912,244 @@ func getCacheKey(addon AddonConfig) string {
 	// Create a unique cache key based on addon configuration
 	key := fmt.Sprintf("%s|%s|%s|%s|%v|%s",
 		addon.Name, addon.URL, addon.Branch, addon.Tag, addon.LatestRelease, addon.AssetPattern)
+	if addon.Provider != "" || addon.BaseURL != "" {
+		key += "|" + addon.Provider + "|" + addon.BaseURL
+	}
+	if isGitSource(addon) {
+		key += "|git|" + addon.Commit
+	}
+	if addon.Version != "" || addon.TagPattern != "" {
+		key += "|" + addon.Version + "|" + addon.TagPattern
+	}
+	if addon.Channel != "" {
+		key += "|channel|" + addon.Channel
+	}
+	if _, isSite := siteAPIURLs[addonProvider(addon)]; isSite {
+		key += "|" + addon.ProjectID + "|" + addon.Flavor + "|" + addon.ReleaseType
+	}
 	hash := sha256.Sum256([]byte(key))
 	return hex.EncodeToString(hash[:])[:16] // Use first 16 chars of hash
 }
 
-func installAddonWithCache(addon AddonConfig, targetDir, cacheDir string, cacheIndex CacheIndex) (bool, error) {
-	cacheKey := getCacheKey(addon)
+// FetchedArchive is an addon archive resolved and stored in the cache, ready for extraction
+type FetchedArchive struct {
+	DownloadURL string
+	Path        string
+	Entry       CacheEntry
+	FromCache   bool
+	Stale       string // Why the cached archive was used without checking for updates
+}
 
-	// Get current download URL
-	downloadURL, err := getDownloadURL(addon)
+func installAddonWithCache(addon AddonConfig, targetDir, cacheDir string, cacheIndex CacheIndex, manifest Manifest) (bool, error) {
+	archive, err := fetchAddonArchive(addon, cacheDir, cacheIndex, false)
 	if err != nil {
-		return false, fmt.Errorf("failed to get download URL: %v", err)
+		return false, err
 	}
+	return installFetchedArchive(addon, archive, targetDir, cacheDir, cacheIndex, manifest)
+}
 
-	// Check if we have a cached version
-	if entry, exists := cacheIndex[cacheKey]; exists {
-		cachedFile := filepath.Join(cacheDir, entry.Filename)
+// Resolve and download an addon into the cache. Only reads the cache index,
+// so it is safe to call concurrently for different addons. A cached archive
+// is revalidated with its ETag or Last-Modified, so an unchanged one isn't
+// downloaded again; with refresh set it is downloaded again regardless.
+func fetchAddonArchive(addon AddonConfig, cacheDir string, cacheIndex CacheIndex, refresh bool) (FetchedArchive, error) {
+	cacheKey := getCacheKey(addon)
+	cached := cacheIndex[cacheKey]
 
-		// Check if cached file exists and URL matches
-		if _, err := os.Stat(cachedFile); err == nil && entry.URL == downloadURL {
-			// Determine if we should check for updates
-			shouldUpdate := false
-			if addon.LatestRelease {
-				// Check for updates if cache is older than 1 hour
-				shouldUpdate = time.Since(entry.LastModified) > time.Hour
-			} else {
-				// For fixed versions, check if cache is older than 24 hours
-				shouldUpdate = time.Since(entry.LastModified) > 24*time.Hour
+	// Get current download URL, on the remembered default branch if the addon follows it
+	branch, branchChecked, err := knownDefaultBranch(addon, cached)
+	var downloadURL string
+	var assets []ReleaseAsset
+	if err == nil {
+		downloadURL, assets, err = getDownloadURL(onBranch(addon, branch))
+	}
+	if err != nil {
+		// Keep the installed version while the API is rate limited
+		var limit *RateLimitError
+		if errors.As(err, &limit) {
+			if entry, exists := cacheIndex[cacheKey]; exists {
+				cachedFile := filepath.Join(cacheDir, entry.Filename)
+				if _, statErr := os.Stat(cachedFile); statErr == nil {
+					return FetchedArchive{DownloadURL: entry.URL, Path: cachedFile, Entry: entry, FromCache: true, Stale: limit.Error()}, nil
+				}
 			}
+		}
+		return FetchedArchive{}, fmt.Errorf("failed to get download URL: %v", err)
+	}
 
-			if !shouldUpdate {
-				// Use cached version - but still extract in case files were deleted
-				return true, extractZip(cachedFile, targetDir, addon)
+	var archive FetchedArchive
+	if isGitSource(addon) {
+		archive, err = fetchGitArchive(addon, cacheDir, cacheIndex)
+	} else {
+		archive, err = saveToCache(addon, downloadURL, cacheDir, cacheIndex, refresh)
+
+		// The remembered default branch may have been renamed since, look it up again
+		if err != nil && branch != "" && branch == cached.DefaultBranch {
+			provider, providerErr := sourceProviderFor(addon)
+			if providerErr == nil {
+				if current, lookupErr := resolveDefaultBranch(addon, provider); lookupErr == nil && current != branch {
+					branch, branchChecked = current, time.Now()
+					downloadURL, assets, err = getDownloadURL(onBranch(addon, branch))
+					if err == nil {
+						archive, err = saveToCache(addon, downloadURL, cacheDir, cacheIndex, refresh)
+					}
+				}
 			}
 		}
 	}
-
-	// Download fresh copy
-	resp, err := http.Get(downloadURL)
 	if err != nil {
-		return false, fmt.Errorf("failed to download: %v", err)
+		return FetchedArchive{}, err
 	}
-	defer resp.Body.Close()
+	archive.Entry.DefaultBranch, archive.Entry.DefaultBranchChecked = branch, branchChecked
 
-	if resp.StatusCode != http.StatusOK {
-		return false, fmt.Errorf("download failed with status: %s", resp.Status)
+	// Reject archives that fail verification before anything is extracted
+	if err := verifyArchive(addon, archive, assets); err != nil {
+		if !archive.FromCache {
+			os.Remove(archive.Path)
+		}
+		return FetchedArchive{}, fmt.Errorf("verification failed: %v", err)
 	}
+	return archive, nil
+}
 
-	// Create cache filename
-	timestamp := time.Now().Format("20060102-150405")
-	cacheFilename := fmt.Sprintf("%s-%s.zip", cacheKey, timestamp)
-	cachePath := filepath.Join(cacheDir, cacheFilename)
+// Download an archive into the cache, reusing the cached file if the contents
+// didn't change. Unless refresh is set, the download is conditional on the
+// cached copy's ETag or Last-Modified, so unchanged archives aren't sent again.
+func saveToCache(addon AddonConfig, downloadURL, cacheDir string, cacheIndex CacheIndex, refresh bool) (FetchedArchive, error) {
+	cacheKey := getCacheKey(addon)
+	headers := downloadHeaders(addon, downloadURL)
+
+	cached, hasCached := cacheIndex[cacheKey]
+	cachedPath := filepath.Join(cacheDir, cached.Filename)
+	if hasCached && !refresh && cached.URL == downloadURL {
+		if _, err := os.Stat(cachedPath); err == nil {
+			if headers == nil {
+				headers = make(map[string]string)
+			}
+			if cached.ETag != "" {
+				headers["If-None-Match"] = cached.ETag
+			}
+			if cached.HTTPLastModified != "" {
+				headers["If-Modified-Since"] = cached.HTTPLastModified
+			}
+		}
+	}
 
-	// Save to cache
-	cacheFile, err := os.Create(cachePath)
+	// Download fresh copy
+	source, responseHeader, err := openArchiveSource(downloadURL, headers)
+	if errors.Is(err, errNotModified) {
+		// Use cached version - installing it still restores deleted files
+		cached.LastModified = time.Now()
+		return FetchedArchive{DownloadURL: downloadURL, Path: cachedPath, Entry: cached, FromCache: true}, nil
+	}
+	if err != nil {
+		return FetchedArchive{}, err
+	}
+	defer source.Close()
+	etag, httpLastModified := responseHeader.Get("ETag"), responseHeader.Get("Last-Modified")
+
+	// Save to a temporary cache file first, the final name depends on the contents
+	cacheFile, err := os.CreateTemp(cacheDir, cacheKey+"-*.tmp")
 	if err != nil {
-		return false, fmt.Errorf("failed to create cache file: %v", err)
+		return FetchedArchive{}, fmt.Errorf("failed to create cache file: %v", err)
 	}
-	defer cacheFile.Close()
+	tempPath := cacheFile.Name()
 
 	// Copy response to cache file and calculate hash
 	hasher := sha256.New()
 	writer := io.MultiWriter(cacheFile, hasher)
 
-	_, err = io.Copy(writer, resp.Body)
+	_, err = io.Copy(writer, source)
+	cacheFile.Close()
 	if err != nil {
-		os.Remove(cachePath) // Clean up on error
-		return false, fmt.Errorf("failed to save download: %v", err)
+		os.Remove(tempPath) // Clean up on error
+		return FetchedArchive{}, fmt.Errorf("failed to save download: %v", err)
 	}
 
 	hash := hex.EncodeToString(hasher.Sum(nil))
 
 	// Check if this is actually a new version by comparing hashes
-	if entry, exists := cacheIndex[cacheKey]; exists && entry.Hash == hash {
-		// Same content, just update timestamp and use existing cache
-		cacheIndex[cacheKey] = CacheEntry{
-			URL:          downloadURL,
-			Hash:         hash,
-			LastModified: time.Now(),
-			Filename:     entry.Filename, // Keep using the old filename
-		}
-		os.Remove(cachePath) // Remove the duplicate file
-
-		// Extract from existing cache
-		existingCachePath := filepath.Join(cacheDir, entry.Filename)
-		if _, err := os.Stat(existingCachePath); err == nil {
-			return true, extractZip(existingCachePath, targetDir, addon)
+	if hasCached && cached.Hash == hash {
+		if _, err := os.Stat(cachedPath); err == nil {
+			os.Remove(tempPath) // Remove the duplicate file
+
+			// Same content, just update timestamp and keep using the old file
+			return FetchedArchive{
+				DownloadURL: downloadURL,
+				Path:        cachedPath,
+				Entry: CacheEntry{
+					URL:              downloadURL,
+					Hash:             hash,
+					LastModified:     time.Now(),
+					Filename:         cached.Filename,
+					ETag:             etag,
+					HTTPLastModified: httpLastModified,
+				},
+				FromCache: true,
+			}, nil
 		}
-		// Fall through to use new file if old one is missing
-		cachePath = existingCachePath
-		cacheFilename = entry.Filename
+		// Fall through to use the new file if the old one is missing
 	}
 
-	// Update cache index with new file
-	cacheIndex[cacheKey] = CacheEntry{
-		URL:          downloadURL,
-		Hash:         hash,
-		LastModified: time.Now(),
-		Filename:     cacheFilename,
-	}
+	// Name includes the hash so two versions fetched in the same second never collide
+	timestamp := time.Now().Format("20060102-150405")
+	cacheFilename := fmt.Sprintf("%s-%s-%s.zip", cacheKey, timestamp, hash[:8])
+	cachePath := filepath.Join(cacheDir, cacheFilename)
+	if err := os.Rename(tempPath, cachePath); err != nil {
+		os.Remove(tempPath)
+		return FetchedArchive{}, fmt.Errorf("failed to save download: %v", err)
+	}
+
+	return FetchedArchive{
+		DownloadURL: downloadURL,
+		Path:        cachePath,
+		Entry: CacheEntry{
+			URL:              downloadURL,
+			Hash:             hash,
+			LastModified:     time.Now(),
+			Filename:         cacheFilename,
+			ETag:             etag,
+			HTTPLastModified: httpLastModified,
+		},
+	}, nil
+}
+
+// Record a fetched archive in the cache index and extract it into the target directory
+func installFetchedArchive(addon AddonConfig, archive FetchedArchive, targetDir, cacheDir string, cacheIndex CacheIndex, manifest Manifest) (bool, error) {
+	cacheKey := getCacheKey(addon)
+	cacheIndex[cacheKey] = archive.Entry
 
 	// Clean up old cache files for this addon
-	cleanupOldCacheFiles(cacheDir, cacheKey, cacheFilename)
+	if !archive.FromCache {
+		cleanupOldCacheFiles(cacheDir, cacheKey, archive.Entry.Filename)
+	}
 
-	// Extract from cache
-	return false, extractZip(cachePath, targetDir, addon)
+	// Skip extraction if the manifest shows this archive is already fully installed
+	if installed, exists := manifest[addon.Name]; exists && installed.ArchiveHash == archive.Entry.Hash &&
+		installed.URL == addon.URL && installed.Layout == layoutKey(addon) && installed.isIntact(targetDir) {
+		return archive.FromCache, nil
+	}
+
+	// Extract from cache through the staging area and record what it wrote
+	stagingDir := filepath.Join(filepath.Dir(cacheDir), "Staging")
+	entry, err := stagedInstall(addon, archive.Path, targetDir, stagingDir, manifest)
+	if err != nil {
+		return archive.FromCache, err
+	}
+	entry.Name = addon.Name
+	entry.URL = addon.URL
+	entry.Source = archive.DownloadURL
+	entry.Version = resolveVersion(addon, archive.DownloadURL)
+	entry.ArchiveHash = archive.Entry.Hash
+	entry.Layout = layoutKey(addon)
+	entry.Commit = archive.Entry.Commit
+	if entry.Version == "" && entry.Commit != "" {
+		entry.Version = shortHash(entry.Commit, 7)
+	}
+	entry.InstalledAt = time.Now()
+	manifest[addon.Name] = entry
+
+	return archive.FromCache, nil
 }
 
 func cleanupOldCacheFiles(cacheDir, cacheKey, currentFilename string) {
@@ -694,54 +1166,133 @@ func cleanupOldCacheFiles(cacheDir, cacheKey, currentFilename string) {
 	}
 }
 
-func addonExists(addon AddonConfig, targetDir string) bool {
+func addonExists(addon AddonConfig, targetDir string, manifest Manifest) bool {
+	if entry, exists := manifest[addon.Name]; exists {
+		return entry.isPresent(targetDir)
+	}
+
+	// Installs from before the manifest existed can only be found by explicit folder
 	if addon.Folder != "" {
 		addonPath := filepath.Join(targetDir, addon.Folder)
 		_, err := os.Stat(addonPath)
 		return err == nil
 	}
 
-	addonDirs, err := findAddonDirectories(addon, targetDir)
+	return false
+}
+
+// New function to backup entire directory with blacklist support
+func backupFullDirectory(dirConfig DirectoryConfig, backupDir string) ([]PruneDecision, error) {
+	if _, err := createFullBackup(dirConfig, backupDir); err != nil {
+		return nil, err
+	}
+
+	// Clean up old backups according to the retention policy
+	decisions, err := pruneFullBackups(dirConfig, backupDir, false)
 	if err != nil {
-		return false
+		return decisions, fmt.Errorf("backup created, but pruning old backups failed: %v", err)
 	}
-	return len(addonDirs) > 0
+
+	return decisions, nil
 }
 
-// New function to backup entire directory with blacklist support
-func backupFullDirectory(dirConfig DirectoryConfig, backupDir string) error {
-	// Create backup with timestamp
-	timestamp := time.Now().Format("20060102-150405")
-	backupName := fmt.Sprintf("%s-full-%s.zip", sanitizeFilename(dirConfig.Name), timestamp)
-	backupPath := filepath.Join(backupDir, backupName)
+// Write a timestamped zip of the installation's addon folders, returning its path
+func createFullBackup(dirConfig DirectoryConfig, backupDir string) (string, error) {
+	switch dirConfig.BackupFormat {
+	case backupFormatStore:
+		return createStoreSnapshot(dirConfig, backupDir)
+	case "", backupFormatZip:
+	default:
+		return "", fmt.Errorf("unknown backup_format '%s'", dirConfig.BackupFormat)
+	}
 
-	// Create zip file
-	zipFile, err := os.Create(backupPath)
+	// Create zip file named after the time, never overwriting an existing backup
+	zipFile, err := createBackupFile(backupDir, dirConfig.Name, ".zip", time.Now())
 	if err != nil {
-		return err
+		return "", err
 	}
-	defer zipFile.Close()
+	backupPath := zipFile.Name()
 
 	zipWriter := zip.NewWriter(zipFile)
-	defer zipWriter.Close()
+	err = writeFullBackup(zipWriter, dirConfig)
+	if closeErr := zipWriter.Close(); err == nil {
+		err = closeErr
+	}
+	if closeErr := zipFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(backupPath) // Don't leave a partial backup behind
+		return "", err
+	}
+
+	return backupPath, nil
+}
+
+// Backups are named after the second they were taken in, with a counter
+// when several are taken within the same second, like MyWoW-full-20240101-120000-2.zip
+const backupTimestampFormat = "20060102-150405"
+
+// Limit on backups taken within one second, so a broken directory can't loop forever
+const maxBackupsPerSecond = 100
+
+// Create a new backup file, never overwriting an existing one
+func createBackupFile(dir, installName, ext string, created time.Time) (*os.File, error) {
+	base := fmt.Sprintf("%s-full-%s", sanitizeFilename(installName), created.Format(backupTimestampFormat))
+	for sequence := 1; ; sequence++ {
+		name := base + ext
+		if sequence > 1 {
+			name = fmt.Sprintf("%s-%d%s", base, sequence, ext)
+		}
+		file, err := os.OpenFile(filepath.Join(dir, name), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if !os.IsExist(err) || sequence >= maxBackupsPerSecond {
+			return file, err
+		}
+	}
+}
+
+func writeFullBackup(zipWriter *zip.Writer, dirConfig DirectoryConfig) error {
+	return walkFullBackupFiles(dirConfig, func(backupPath, path string, info os.FileInfo) error {
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
 
+		writer, err := zipWriter.Create(backupPath)
+		if err != nil {
+			return err
+		}
+
+		_, err = io.Copy(writer, file)
+		return err
+	})
+}
+
+// Call fn for every file a full backup of the installation contains, with
+// its slash-separated path inside the backup
+func walkFullBackupFiles(dirConfig DirectoryConfig, fn func(backupPath, path string, info os.FileInfo) error) error {
 	// Get list of addon directories to backup (with blacklist filtering)
 	addonDirs, err := getAddonDirectoriesToBackup(dirConfig)
 	if err != nil {
 		return err
 	}
 
-	// Add each addon directory to the zip
+	// Add each addon directory
 	for _, addonPath := range addonDirs {
 		addonName := filepath.Base(addonPath)
-		err = addDirToZip(zipWriter, addonPath, addonName)
+		err = walkBackupDir(addonPath, addonName, nil, fn)
 		if err != nil {
 			return fmt.Errorf("failed to add %s to backup: %v", addonName, err)
 		}
 	}
 
-	// Clean up old backups (keep last 5 full backups)
-	cleanupOldFullBackups(backupDir, dirConfig.Name)
+	// Add account and character settings from WTF
+	if wtfDir := findWTFDirectory(dirConfig.Path); wtfDir != "" {
+		if err := walkBackupDir(wtfDir, wtfBackupFolder, wtfExclude(dirConfig), fn); err != nil {
+			return fmt.Errorf("failed to add WTF settings to backup: %v", err)
+		}
+	}
 
 	return nil
 }
@@ -830,63 +1381,34 @@ func getDefaultBlacklist() []string {
 	}
 }
 
-// Clean up old full backups (keep last 5)
-func cleanupOldFullBackups(backupDir, installName string) {
-	entries, err := os.ReadDir(backupDir)
-	if err != nil {
-		return
-	}
-
-	sanitizedName := sanitizeFilename(installName)
-	prefix := sanitizedName + "-full-"
-
-	var backupFiles []os.DirEntry
-	for _, entry := range entries {
-		if !entry.IsDir() && strings.HasPrefix(entry.Name(), prefix) && strings.HasSuffix(entry.Name(), ".zip") {
-			backupFiles = append(backupFiles, entry)
-		}
-	}
-
-	// Keep only the 5 most recent backups
-	if len(backupFiles) > 5 {
-		// Sort by name (which includes timestamp) and remove oldest
-		for i := 0; i < len(backupFiles)-5; i++ {
-			os.Remove(filepath.Join(backupDir, backupFiles[i].Name()))
-		}
-	}
-}
-
-func addDirToZip(zipWriter *zip.Writer, srcDir, baseInZip string) error {
+// Walk the files of a directory stored under base in a backup, skipping
+// paths exclude returns true for
+func walkBackupDir(srcDir, base string, exclude func(relPath string) bool, fn func(backupPath, path string, info os.FileInfo) error) error {
 	return filepath.Walk(srcDir, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
 
-		if info.IsDir() {
-			return nil
-		}
-
 		relPath, err := filepath.Rel(srcDir, path)
 		if err != nil {
 			return err
 		}
 
-		zipPath := filepath.Join(baseInZip, relPath)
-		zipPath = strings.ReplaceAll(zipPath, "\\", "/") // Normalize for zip
-
-		file, err := os.Open(path)
-		if err != nil {
-			return err
+		if exclude != nil && relPath != "." && exclude(relPath) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
 		}
-		defer file.Close()
 
-		writer, err := zipWriter.Create(zipPath)
-		if err != nil {
-			return err
+		if info.IsDir() {
+			return nil
 		}
 
-		_, err = io.Copy(writer, file)
-		return err
+		backupPath := filepath.Join(base, relPath)
+		backupPath = strings.ReplaceAll(backupPath, "\\", "/") // Normalize for zip
+
+		return fn(backupPath, path, info)
 	})
 }
 
@@ -979,8 +1501,33 @@ func printHelp() {
 	fmt.Println("  aggon                    Start interactive menu")
 	fmt.Println("  aggon add addon          Add addon")
 	fmt.Println("  aggon add path           Add path")
+	fmt.Println("  aggon install [--dir NAME] [--force] [--jobs N] [--refresh] [addon...]")
+	fmt.Println("                           Install addons without prompting")
+	fmt.Println("  aggon update [--dir NAME] [--force] [--jobs N] [--refresh] [addon...]")
+	fmt.Println("                           Check all addons for updates, --refresh downloads every archive again")
+	fmt.Println("  aggon list [--dir NAME]  List configured addons and their status")
+	fmt.Println("  aggon remove [--dir NAME] [--force] <addon>...")
+	fmt.Println("                           Uninstall addons and remove them from config")
+	fmt.Println("  aggon enable <addon>...  Enable addons in config")
+	fmt.Println("  aggon disable <addon>... Disable addons in config")
+	fmt.Println("  aggon backup [--dir NAME]")
+	fmt.Println("                           Back up installations")
+	fmt.Println("  aggon prune [--dir NAME] [--dry-run]")
+	fmt.Println("                           Apply backup retention policies")
+	fmt.Println("  aggon export --dir NAME [--backup FILE|N|latest] [--out FILE]")
+	fmt.Println("                           Export a backup as a plain zip")
+	fmt.Println("  aggon restore --list [--dir NAME]")
+	fmt.Println("                           List available backups")
+	fmt.Println("  aggon restore --dir NAME [--backup FILE|N|latest] [--settings] [addon|folder...]")
+	fmt.Println("                           Restore an installation, selected folders or settings")
+	fmt.Println("  aggon info <addon>       Show installed addon details")
+	fmt.Println("  aggon ignore [--dir NAME] [--pattern PATTERN]... <addon>")
+	fmt.Println("                           Preview which files of the cached archive ignore excludes")
 	fmt.Println("  aggon format-config      Format config file")
 	fmt.Println("  aggon --help             Show this help")
+	fmt.Println()
+	fmt.Println("Commands other than the menu and wizards never prompt. They exit with")
+	fmt.Println("0 on success, 1 if anything failed and 2 for usage or config errors.")
 }
 
 func waitForEnter() {
@@ -1068,159 +1615,222 @@ func createSampleConfig() {
 	saveConfigFormatted(file, config)
 }
 
-func getDownloadURL(addon AddonConfig) (string, error) {
-	githubURL := strings.TrimSuffix(addon.URL, "/")
+// Get a copy of an addon set to download the given branch, if any
+func onBranch(addon AddonConfig, branch string) AddonConfig {
+	if branch != "" {
+		addon.Branch = branch
+	}
+	return addon
+}
+
+// Resolve an addon's download URL. Release downloads also return the
+// release's assets, which may hold checksums and signatures for the archive.
+func getDownloadURL(addon AddonConfig) (string, []ReleaseAsset, error) {
+	if isLocalSource(addon.URL) || isGitSource(addon) {
+		return addon.URL, nil, nil
+	}
+	if site, isSite := addonSiteFor(addon); isSite {
+		downloadURL, err := getSiteDownloadURL(addon, site)
+		return downloadURL, nil, err
+	}
+
+	provider, err := sourceProviderFor(addon)
+	if err != nil {
+		return "", nil, err
+	}
 
-	if !strings.Contains(githubURL, "github.com") {
-		return "", fmt.Errorf("not a GitHub URL")
+	selector, err := newTagSelector(addon)
+	if err != nil {
+		return "", nil, err
+	}
+	channel, err := parseChannel(addon.Channel)
+	if err != nil {
+		return "", nil, err
 	}
 
 	var downloadURL string
+	var assets []ReleaseAsset
 
 	if addon.LatestRelease {
-		releaseURL, err := getLatestReleaseURL(addon, githubURL)
+		releaseURL, releaseAssets, err := getLatestReleaseURL(addon, provider, selector, channel)
+		if err != nil {
+			return "", nil, fmt.Errorf("failed to get latest release: %w", err)
+		}
+		downloadURL, assets = releaseURL, releaseAssets
+	} else if selector != nil {
+		tags, err := provider.listTags()
+		if err != nil {
+			return "", nil, fmt.Errorf("failed to list tags: %w", err)
+		}
+		tag, err := selector.pick(tags, channel)
 		if err != nil {
-			return "", fmt.Errorf("failed to get latest release: %v", err)
+			return "", nil, err
 		}
-		downloadURL = releaseURL
+		downloadURL = provider.archiveURL(tag, true)
 	} else if addon.Tag != "" {
-		downloadURL = githubURL + "/archive/refs/tags/" + addon.Tag + ".zip"
+		downloadURL = provider.archiveURL(addon.Tag, true)
 	} else if addon.Branch != "" {
-		downloadURL = githubURL + "/archive/refs/heads/" + addon.Branch + ".zip"
+		downloadURL = provider.archiveURL(addon.Branch, false)
 	} else {
-		downloadURL = githubURL + "/archive/refs/heads/main.zip"
-		resp, err := http.Head(downloadURL)
-		if err != nil || resp.StatusCode != http.StatusOK {
-			downloadURL = githubURL + "/archive/refs/heads/master.zip"
+		branch, err := resolveDefaultBranch(addon, provider)
+		if err != nil {
+			return "", nil, err
 		}
+		downloadURL = provider.archiveURL(branch, false)
 	}
 
-	return downloadURL, nil
+	return downloadURL, assets, nil
 }
 
-func extractZip(src, dest string, addon AddonConfig) error {
+func extractZip(src, dest string, addon AddonConfig) (ManifestEntry, error) {
+	entry := ManifestEntry{Files: make(map[string]string)}
+
 	reader, err := zip.OpenReader(src)
 	if err != nil {
-		return err
+		return entry, err
 	}
 	defer reader.Close()
 
-	var rootFolder string
-	if len(reader.File) > 0 {
-		rootFolder = strings.Split(reader.File[0].Name, "/")[0]
+	// Refuse unsafe archives before writing anything
+	limits := addon.Limits.withDefaults()
+	if err := checkArchiveEntries(reader.File, limits); err != nil {
+		return entry, err
 	}
+	budget := &extractBudget{remaining: limits.MaxSize, limit: limits.MaxSize}
 
-	for _, file := range reader.File {
-		if file.FileInfo().IsDir() || strings.HasPrefix(filepath.Base(file.Name), ".") {
-			continue
-		}
-
-		relativePath := strings.TrimPrefix(file.Name, rootFolder+"/")
-		if relativePath == file.Name {
-			relativePath = file.Name
-		}
-
-		if shouldIgnoreFile(relativePath, addon.Ignore) {
-			continue
-		}
+	planned, err := planArchiveFiles(reader.File, addon)
+	if err != nil {
+		return entry, err
+	}
 
-		var destPath string
-		if addon.Folder != "" {
-			destPath = filepath.Join(dest, addon.Folder, relativePath)
-		} else {
-			destPath = filepath.Join(dest, relativePath)
+	for _, plan := range planned {
+		file := plan.File
+		destPath, err := containedPath(dest, plan.Path)
+		if err != nil {
+			return entry, err
 		}
 
 		if err := os.MkdirAll(filepath.Dir(destPath), 0755); err != nil {
-			return err
+			return entry, err
 		}
 
 		rc, err := file.Open()
 		if err != nil {
-			return err
+			return entry, err
 		}
 
 		outFile, err := os.Create(destPath)
 		if err != nil {
 			rc.Close()
-			return err
+			return entry, err
 		}
 
-		_, err = io.Copy(outFile, rc)
+		// Hash while writing so the manifest records exactly what landed on disk
+		hasher := sha256.New()
+		err = budget.copy(io.MultiWriter(outFile, hasher), rc)
 		outFile.Close()
 		rc.Close()
 
 		if err != nil {
-			return err
+			os.Remove(destPath) // Don't leave a truncated file behind
+			return entry, err
 		}
+
+		relPath, err := filepath.Rel(dest, destPath)
+		if err != nil {
+			return entry, err
+		}
+		entry.Files[filepath.ToSlash(relPath)] = hex.EncodeToString(hasher.Sum(nil))
 	}
 
-	return nil
+	entry.Folders = manifestFolders(entry.Files)
+	return entry, nil
 }
 
-func shouldIgnoreFile(filePath string, ignoreList []string) bool {
-	if len(ignoreList) == 0 {
-		return false
+func getLatestReleaseURL(addon AddonConfig, provider SourceProvider, selector *TagSelector, channel int) (string, []ReleaseAsset, error) {
+	release, err := selectRelease(provider, selector, channel)
+	if err != nil {
+		return "", nil, err
 	}
 
-	fileName := filepath.Base(filePath)
-
-	for _, ignorePattern := range ignoreList {
-		if fileName == ignorePattern || filePath == ignorePattern || strings.Contains(filePath, ignorePattern) {
-			return true
+	// Checksums and signatures aren't installable archives
+	var archives []ReleaseAsset
+	for _, asset := range release.Assets {
+		if !isVerificationAsset(asset.Name) {
+			archives = append(archives, asset)
 		}
 	}
 
-	return false
-}
-
-func getLatestReleaseURL(addon AddonConfig, githubURL string) (string, error) {
-	parts := strings.Split(githubURL, "/")
-	if len(parts) < 5 {
-		return "", fmt.Errorf("invalid GitHub URL format")
+	if len(archives) == 0 {
+		return "", nil, fmt.Errorf("no assets found in latest release")
 	}
 
-	owner := parts[3]
-	repo := parts[4]
-	apiURL := fmt.Sprintf("https://api.github.com/repos/%s/%s/releases/latest", owner, repo)
-
-	resp, err := http.Get(apiURL)
-	if err != nil {
-		return "", fmt.Errorf("failed to fetch release info: %v", err)
+	if addon.AssetPattern != "" {
+		for _, asset := range archives {
+			if strings.Contains(strings.ToLower(asset.Name), strings.ToLower(addon.AssetPattern)) {
+				return asset.URL, release.Assets, nil
+			}
+		}
+		return "", nil, fmt.Errorf("no asset matching pattern '%s' found", addon.AssetPattern)
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("GitHub API returned status: %s", resp.Status)
+	if len(archives) > 1 {
+		var assetNames []string
+		for _, asset := range archives {
+			assetNames = append(assetNames, asset.Name)
+		}
+		return "", nil, fmt.Errorf("multiple assets found, please specify asset_pattern. Available assets: %s", strings.Join(assetNames, ", "))
 	}
 
-	var release GitHubRelease
-	if err := json.NewDecoder(resp.Body).Decode(&release); err != nil {
-		return "", fmt.Errorf("failed to parse release info: %v", err)
+	return archives[0].URL, release.Assets, nil
+}
+
+// Get the newest release allowed on the channel, or the highest one matching
+// the addon's version constraint and tag pattern
+func selectRelease(provider SourceProvider, selector *TagSelector, channel int) (SourceRelease, error) {
+	// The latest release endpoints leave out flagged prereleases, those only
+	// named like one, such as v2.0-beta1, are filtered from the full list
+	if selector == nil && channel == releaseTypeRelease {
+		release, err := provider.latestRelease()
+		if err != nil || release.channel() == releaseTypeRelease {
+			return release, err
+		}
 	}
 
-	if len(release.Assets) == 0 {
-		return "", fmt.Errorf("no assets found in latest release")
+	releases, err := provider.listReleases()
+	if err != nil {
+		return SourceRelease{}, err
+	}
+	if selector != nil {
+		channel = selector.allowedChannel(channel)
 	}
 
-	if addon.AssetPattern != "" {
-		for _, asset := range release.Assets {
-			if strings.Contains(strings.ToLower(asset.Name), strings.ToLower(addon.AssetPattern)) {
-				return asset.BrowserDownloadURL, nil
-			}
+	var allowed []SourceRelease
+	var tags []string
+	for _, release := range releases {
+		if release.channel() <= channel {
+			allowed = append(allowed, release)
+			tags = append(tags, release.Tag)
 		}
-		return "", fmt.Errorf("no asset matching pattern '%s' found", addon.AssetPattern)
 	}
 
-	if len(release.Assets) > 1 {
-		var assetNames []string
-		for _, asset := range release.Assets {
-			assetNames = append(assetNames, asset.Name)
+	if selector == nil {
+		if len(allowed) == 0 {
+			return SourceRelease{}, fmt.Errorf("no releases found on the %s channel", channelNames[channel])
 		}
-		return "", fmt.Errorf("multiple assets found, please specify asset_pattern. Available assets: %s", strings.Join(assetNames, ", "))
+		return allowed[0], nil
 	}
 
-	return release.Assets[0].BrowserDownloadURL, nil
+	tag, err := selector.pick(tags, channel)
+	if err != nil {
+		return SourceRelease{}, err
+	}
+	for _, release := range allowed {
+		if release.Tag == tag {
+			return release, nil
+		}
+	}
+	return SourceRelease{}, fmt.Errorf("release '%s' not found", tag)
 }
 
 func saveConfig(filename string, config Config) error {
@@ -1241,27 +1851,36 @@ func saveConfigFormatted(file *os.File, config Config) error {
 		output += fmt.Sprintf("        \"name\": %q,\n", dir.Name)
 		output += fmt.Sprintf("        \"path\": %q,\n", dir.Path)
 
-		// Add backup_blacklist if present
-		if len(dir.BackupBlacklist) > 0 {
-			if len(dir.BackupBlacklist) <= 5 {
-				// Single line format for 5 or fewer items
-				var items []string
-				for _, item := range dir.BackupBlacklist {
-					items = append(items, fmt.Sprintf("%q", item))
-				}
-				output += fmt.Sprintf("        \"backup_blacklist\": [ %s ],\n", strings.Join(items, ", "))
-			} else {
-				// Multi-line format for more than 5 items
-				output += "        \"backup_blacklist\": [\n"
-				for i, item := range dir.BackupBlacklist {
-					if i == len(dir.BackupBlacklist)-1 {
-						output += fmt.Sprintf("            %q\n", item)
-					} else {
-						output += fmt.Sprintf("            %q,\n", item)
-					}
-				}
-				output += "        ],\n"
-			}
+		// Add backup_blacklist and wtf_blacklist if present
+		output += formatConfigList("backup_blacklist", dir.BackupBlacklist)
+		output += formatConfigList("wtf_blacklist", dir.WTFBlacklist)
+
+		if dir.BackupFormat != "" {
+			output += fmt.Sprintf("        \"backup_format\": %q,\n", dir.BackupFormat)
+		}
+		if dir.StrictDependencies {
+			output += "        \"strict_dependencies\": true,\n"
+		}
+		if dir.Concurrency > 0 {
+			output += fmt.Sprintf("        \"concurrency\": %d,\n", dir.Concurrency)
+		}
+		if dir.Retention != nil {
+			output += fmt.Sprintf("        \"retention\": %s,\n", formatRetention(*dir.Retention))
+		}
+		if dir.Flavor != "" {
+			output += fmt.Sprintf("        \"flavor\": %q,\n", dir.Flavor)
+		}
+		if dir.Channel != "" {
+			output += fmt.Sprintf("        \"channel\": %q,\n", dir.Channel)
+		}
+		if dir.MaxExtractSizeMB > 0 {
+			output += fmt.Sprintf("        \"max_extract_size_mb\": %d,\n", dir.MaxExtractSizeMB)
+		}
+		if dir.MaxExtractFiles > 0 {
+			output += fmt.Sprintf("        \"max_extract_files\": %d,\n", dir.MaxExtractFiles)
+		}
+		if len(dir.APIKeys) > 0 {
+			output += fmt.Sprintf("        \"api_keys\": %s,\n", formatStringMap(dir.APIKeys))
 		}
 
 		output += "        \"addons\": [\n"
@@ -1271,7 +1890,7 @@ func saveConfigFormatted(file *os.File, config Config) error {
 
 			var fields []string
 
-			// Field order: disabled (if present), name, url, folder, ignore, branch, tag, latest_release, asset_pattern
+			// Field order: disabled (if present), name, url, provider, base_url, project_id, flavor, release_type, folder, paths, ignore, preserve, branch, tag, version, tag_pattern, latest_release, channel, asset_pattern, sha256, signing_key, git, commit
 
 			// 1. disabled (only if true)
 			if addon.Disabled {
@@ -1284,33 +1903,41 @@ func saveConfigFormatted(file *os.File, config Config) error {
 			// 3. url (always present)
 			fields = append(fields, fmt.Sprintf("                \"url\": %q", addon.URL))
 
+			// 3a. provider and base_url (optional, for self-hosted servers)
+			if addon.Provider != "" {
+				fields = append(fields, fmt.Sprintf("                \"provider\": %q", addon.Provider))
+			}
+			if addon.BaseURL != "" {
+				fields = append(fields, fmt.Sprintf("                \"base_url\": %q", addon.BaseURL))
+			}
+
+			// 3b. addon site settings (optional)
+			if addon.ProjectID != "" {
+				fields = append(fields, fmt.Sprintf("                \"project_id\": %q", addon.ProjectID))
+			}
+			if addon.Flavor != "" {
+				fields = append(fields, fmt.Sprintf("                \"flavor\": %q", addon.Flavor))
+			}
+			if addon.ReleaseType != "" {
+				fields = append(fields, fmt.Sprintf("                \"release_type\": %q", addon.ReleaseType))
+			}
+
 			// 4. folder (optional)
 			if addon.Folder != "" {
 				fields = append(fields, fmt.Sprintf("                \"folder\": %q", addon.Folder))
 			}
 
-			// 5. ignore (optional, with special formatting)
+			// 4a. paths (optional, one mapping per line)
+			if len(addon.Paths) > 0 {
+				fields = append(fields, formatPathMappings(addon.Paths))
+			}
+
+			// 5. ignore and preserve (optional, with special formatting)
 			if len(addon.Ignore) > 0 {
-				if len(addon.Ignore) <= 5 {
-					// Single line format for 5 or fewer items with proper spacing
-					var items []string
-					for _, item := range addon.Ignore {
-						items = append(items, fmt.Sprintf("%q", item))
-					}
-					fields = append(fields, fmt.Sprintf("                \"ignore\": [ %s ]", strings.Join(items, ", ")))
-				} else {
-					// Multi-line format for more than 5 items
-					ignoreField := "                \"ignore\": [\n"
-					for i, item := range addon.Ignore {
-						if i == len(addon.Ignore)-1 {
-							ignoreField += fmt.Sprintf("                    %q\n", item)
-						} else {
-							ignoreField += fmt.Sprintf("                    %q,\n", item)
-						}
-					}
-					ignoreField += "                ]"
-					fields = append(fields, ignoreField)
-				}
+				fields = append(fields, formatAddonList("ignore", addon.Ignore))
+			}
+			if len(addon.Preserve) > 0 {
+				fields = append(fields, formatAddonList("preserve", addon.Preserve))
 			}
 
 			// 6. branch (optional)
@@ -1323,16 +1950,45 @@ func saveConfigFormatted(file *os.File, config Config) error {
 				fields = append(fields, fmt.Sprintf("                \"tag\": %q", addon.Tag))
 			}
 
+			// 7a. version and tag_pattern (optional)
+			if addon.Version != "" {
+				fields = append(fields, fmt.Sprintf("                \"version\": %q", addon.Version))
+			}
+			if addon.TagPattern != "" {
+				fields = append(fields, fmt.Sprintf("                \"tag_pattern\": %q", addon.TagPattern))
+			}
+
 			// 8. latest_release (optional)
 			if addon.LatestRelease {
 				fields = append(fields, "                \"latest_release\": true")
 			}
 
+			// 8a. channel (optional)
+			if addon.Channel != "" {
+				fields = append(fields, fmt.Sprintf("                \"channel\": %q", addon.Channel))
+			}
+
 			// 9. asset_pattern (optional)
 			if addon.AssetPattern != "" {
 				fields = append(fields, fmt.Sprintf("                \"asset_pattern\": %q", addon.AssetPattern))
 			}
 
+			// 9a. sha256 and signing_key (optional)
+			if addon.SHA256 != "" {
+				fields = append(fields, fmt.Sprintf("                \"sha256\": %q", addon.SHA256))
+			}
+			if addon.SigningKey != "" {
+				fields = append(fields, fmt.Sprintf("                \"signing_key\": %q", addon.SigningKey))
+			}
+
+			// 10. git and commit (optional)
+			if addon.Git {
+				fields = append(fields, "                \"git\": true")
+			}
+			if addon.Commit != "" {
+				fields = append(fields, fmt.Sprintf("                \"commit\": %q", addon.Commit))
+			}
+
 			// Join fields with commas
 			output += strings.Join(fields, ",\n")
 			output += "\n            }"
@@ -1355,79 +2011,110 @@ func saveConfigFormatted(file *os.File, config Config) error {
 	return err
 }
 
-func formatConfig() error {
-	config, err := loadConfig("config.json")
-	if err != nil {
-		return err
+// Format a string map as a single line of JSON for the config file
+func formatStringMap(values map[string]string) string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
 	}
+	sort.Strings(keys)
 
-	return saveConfig("config.json", config)
+	var fields []string
+	for _, key := range keys {
+		fields = append(fields, fmt.Sprintf("%q: %q", key, values[key]))
+	}
+	return "{ " + strings.Join(fields, ", ") + " }"
 }
 
-func uninstallAddon(addon AddonConfig, targetDir string) error {
-	if addon.Folder != "" {
-		addonPath := filepath.Join(targetDir, addon.Folder)
-		if _, err := os.Stat(addonPath); err == nil {
-			return os.RemoveAll(addonPath)
-		}
-		return nil
+// Format a directory-level string list, on one line for 5 or fewer items
+func formatConfigList(key string, list []string) string {
+	if len(list) == 0 {
+		return ""
 	}
 
-	addonDirs, err := findAddonDirectories(addon, targetDir)
-	if err != nil {
-		return fmt.Errorf("failed to find addon directories: %v", err)
+	if len(list) <= 5 {
+		var items []string
+		for _, item := range list {
+			items = append(items, fmt.Sprintf("%q", item))
+		}
+		return fmt.Sprintf("        %q: [ %s ],\n", key, strings.Join(items, ", "))
 	}
 
-	if len(addonDirs) == 0 {
-		return nil
+	output := fmt.Sprintf("        %q: [\n", key)
+	for i, item := range list {
+		if i == len(list)-1 {
+			output += fmt.Sprintf("            %q\n", item)
+		} else {
+			output += fmt.Sprintf("            %q,\n", item)
+		}
 	}
+	return output + "        ],\n"
+}
 
-	for _, dir := range addonDirs {
-		if err := os.RemoveAll(dir); err != nil {
-			return fmt.Errorf("failed to remove directory %s: %v", dir, err)
+// Format a list field of an addon, on one line for up to 5 items
+func formatAddonList(name string, list []string) string {
+	if len(list) <= 5 {
+		// Single line format for 5 or fewer items with proper spacing
+		var items []string
+		for _, item := range list {
+			items = append(items, fmt.Sprintf("%q", item))
 		}
+		return fmt.Sprintf("                %q: [ %s ]", name, strings.Join(items, ", "))
 	}
 
-	return nil
+	// Multi-line format for more than 5 items
+	field := fmt.Sprintf("                %q: [\n", name)
+	for i, item := range list {
+		if i == len(list)-1 {
+			field += fmt.Sprintf("                    %q\n", item)
+		} else {
+			field += fmt.Sprintf("                    %q,\n", item)
+		}
+	}
+	return field + "                ]"
 }
 
-func findAddonDirectories(addon AddonConfig, targetDir string) ([]string, error) {
-	var addonDirs []string
+// Format the paths mappings of an addon, on one line for a single mapping
+func formatPathMappings(mappings []PathMapping) string {
+	var items []string
+	for _, mapping := range mappings {
+		item := fmt.Sprintf("{ \"source\": %q", mapping.Source)
+		if mapping.Folder != "" {
+			item += fmt.Sprintf(", \"folder\": %q", mapping.Folder)
+		}
+		items = append(items, item+" }")
+	}
+	if len(items) == 1 {
+		return fmt.Sprintf("                \"paths\": [ %s ]", items[0])
+	}
+	return "                \"paths\": [\n                    " + strings.Join(items, ",\n                    ") + "\n                ]"
+}
 
-	entries, err := os.ReadDir(targetDir)
+func formatConfig() error {
+	config, err := loadConfig("config.json")
 	if err != nil {
-		if os.IsNotExist(err) {
-			return addonDirs, nil
-		}
-		return nil, err
+		return err
 	}
 
-	addonNameLower := strings.ToLower(addon.Name)
-	repoName := getRepoName(addon.URL)
-	repoNameLower := strings.ToLower(repoName)
+	return saveConfig("config.json", config)
+}
 
-	for _, entry := range entries {
-		if !entry.IsDir() {
-			continue
+func uninstallAddon(addon AddonConfig, targetDir string, manifest Manifest) error {
+	if entry, exists := manifest[addon.Name]; exists {
+		if err := entry.remove(targetDir); err != nil {
+			return fmt.Errorf("failed to remove installed files: %v", err)
 		}
+		delete(manifest, addon.Name)
+		return nil
+	}
 
-		dirName := entry.Name()
-		dirNameLower := strings.ToLower(dirName)
-
-		if strings.Contains(dirNameLower, addonNameLower) ||
-			strings.Contains(dirNameLower, repoNameLower) ||
-			strings.Contains(addonNameLower, dirNameLower) {
-			addonDirs = append(addonDirs, filepath.Join(targetDir, dirName))
+	// Installs from before the manifest existed can only be removed by explicit folder
+	if addon.Folder != "" {
+		addonPath := filepath.Join(targetDir, addon.Folder)
+		if _, err := os.Stat(addonPath); err == nil {
+			return os.RemoveAll(addonPath)
 		}
 	}
 
-	return addonDirs, nil
-}
-
-func getRepoName(githubURL string) string {
-	parts := strings.Split(strings.TrimSuffix(githubURL, "/"), "/")
-	if len(parts) > 0 {
-		return parts[len(parts)-1]
-	}
-	return ""
+	return nil
 }
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ManifestEntry records exactly what an addon wrote into an installation
+type ManifestEntry struct {
+	Name         string            `json:"name"`
+	URL          string            `json:"url"`
+	Source       string            `json:"source,omitempty"`
+	Version      string            `json:"version,omitempty"`
+	ArchiveHash  string            `json:"archive_hash,omitempty"`
+	Layout       string            `json:"layout,omitempty"` // layoutKey of the settings it was extracted with
+	Commit       string            `json:"commit,omitempty"`
+	InstalledAt  time.Time         `json:"installed_at"`
+	RestoredFrom string            `json:"restored_from,omitempty"`
+	Folders      []string          `json:"folders,omitempty"`
+	Files        map[string]string `json:"files"`
+}
+
+// Manifest maps addon names to what they installed
+type Manifest map[string]ManifestEntry
+
+func loadManifest(aggonDir string) Manifest {
+	manifestPath := filepath.Join(aggonDir, "manifest.json")
+	file, err := os.Open(manifestPath)
+	if err != nil {
+		return make(Manifest)
+	}
+	defer file.Close()
+
+	var manifest Manifest
+	if err := json.NewDecoder(file).Decode(&manifest); err != nil {
+		return make(Manifest)
+	}
+	if manifest == nil {
+		manifest = make(Manifest)
+	}
+	return manifest
+}
+
+func saveManifest(aggonDir string, manifest Manifest) error {
+	manifestPath := filepath.Join(aggonDir, "manifest.json")
+	file, err := os.Create(manifestPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	encoder := json.NewEncoder(file)
+	encoder.SetIndent("", "    ")
+	return encoder.Encode(manifest)
+}
+
+// Folder names are the top-level directories the recorded files live in
+func manifestFolders(files map[string]string) []string {
+	seen := make(map[string]bool)
+	var folders []string
+	for relPath := range files {
+		parts := strings.SplitN(relPath, "/", 2)
+		if len(parts) < 2 || seen[parts[0]] {
+			continue
+		}
+		seen[parts[0]] = true
+		folders = append(folders, parts[0])
+	}
+	sort.Strings(folders)
+	return folders
+}
+
+// Shorten a hash for display, leaving hand-edited short values as they are
+func shortHash(hash string, length int) string {
+	if len(hash) > length {
+		return hash[:length]
+	}
+	return hash
+}
+
+func hashFile(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hasher := sha256.New()
+	if _, err := io.Copy(hasher, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
+
+// Re-record the files of entries owning any of the given folders after they
+// were restored from a backup. The archive hash is kept, so the restored files
+// stay in place until the addon's source actually changes.
+func rescanManifest(manifest Manifest, targetDir string, folders map[string]bool, restoredFrom string) {
+	for name, entry := range manifest {
+		touched := false
+		for _, folder := range entry.Folders {
+			if folders[folder] {
+				touched = true
+				break
+			}
+		}
+		if !touched {
+			continue
+		}
+
+		// Files in the AddOns root aren't part of any restored folder
+		files := make(map[string]string)
+		for relPath, hash := range entry.Files {
+			if !strings.Contains(relPath, "/") {
+				files[relPath] = hash
+			}
+		}
+
+		for _, folder := range entry.Folders {
+			filepath.Walk(filepath.Join(targetDir, folder), func(path string, info os.FileInfo, err error) error {
+				if err != nil || info.IsDir() {
+					return nil
+				}
+				hash, err := hashFile(path)
+				if err != nil {
+					return nil
+				}
+				if relPath, err := filepath.Rel(targetDir, path); err == nil {
+					files[filepath.ToSlash(relPath)] = hash
+				}
+				return nil
+			})
+		}
+
+		if len(files) == 0 {
+			delete(manifest, name)
+			continue
+		}
+
+		entry.Files = files
+		entry.Folders = manifestFolders(files)
+		entry.RestoredFrom = restoredFrom
+		manifest[name] = entry
+	}
+}
+
+// Check if any recorded file is still on disk
+func (e ManifestEntry) isPresent(targetDir string) bool {
+	for relPath := range e.Files {
+		if _, err := os.Stat(filepath.Join(targetDir, filepath.FromSlash(relPath))); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// Check if every recorded file is still on disk
+func (e ManifestEntry) isIntact(targetDir string) bool {
+	if len(e.Files) == 0 {
+		return false
+	}
+	for relPath := range e.Files {
+		if _, err := os.Stat(filepath.Join(targetDir, filepath.FromSlash(relPath))); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// Remove recorded files, then any recorded folders left empty
+func (e ManifestEntry) remove(targetDir string) error {
+	for relPath := range e.Files {
+		path := filepath.Join(targetDir, filepath.FromSlash(relPath))
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	for _, folder := range e.Folders {
+		removeEmptyDirs(filepath.Join(targetDir, folder))
+	}
+	return nil
+}
+
+// Remove empty directories bottom-up, leaving anything with content in place
+func removeEmptyDirs(root string) {
+	var dirs []string
+	filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err == nil && info.IsDir() {
+			dirs = append(dirs, path)
+		}
+		return nil
+	})
+
+	// Deepest paths first
+	for i := len(dirs) - 1; i >= 0; i-- {
+		os.Remove(dirs[i])
+	}
+}
+
+// Work out which version a download URL refers to
+func resolveVersion(addon AddonConfig, downloadURL string) string {
+	if addon.Tag != "" {
+		return addon.Tag
+	}
+
+	// Release assets: .../releases/download/<tag>/<asset>
+	if idx := strings.Index(downloadURL, "/releases/download/"); idx >= 0 {
+		rest := downloadURL[idx+len("/releases/download/"):]
+		return strings.SplitN(rest, "/", 2)[0]
+	}
+
+	// Archives: .../archive/refs/(heads|tags)/<ref>.zip
+	for _, marker := range []string{"/archive/refs/heads/", "/archive/refs/tags/"} {
+		if idx := strings.Index(downloadURL, marker); idx >= 0 {
+			return strings.TrimSuffix(downloadURL[idx+len(marker):], ".zip")
+		}
+	}
+
+	// GitLab archives: .../-/archive/<ref>/<project>-<ref>.zip
+	if idx := strings.Index(downloadURL, "/-/archive/"); idx >= 0 {
+		rest := downloadURL[idx+len("/-/archive/"):]
+		if end := strings.LastIndex(rest, "/"); end > 0 {
+			return rest[:end]
+		}
+	}
+
+	// Gitea and Forgejo archives: .../archive/<ref>.zip
+	if idx := strings.Index(downloadURL, "/archive/"); idx >= 0 {
+		return strings.TrimSuffix(downloadURL[idx+len("/archive/"):], ".zip")
+	}
+
+	return ""
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Longest wait for a rate limit to pass before giving up on a request
+const maxRateLimitWait = time.Minute
+
+// RateLimitError reports a provider API refusing requests until its limit resets
+type RateLimitError struct {
+	Provider  string
+	Reset     time.Time
+	Anonymous bool // No token was sent, which gets a much lower limit
+}
+
+func (e *RateLimitError) Error() string {
+	message := fmt.Sprintf("%s API rate limit exceeded", e.Provider)
+	if !e.Reset.IsZero() {
+		message += ", resets at " + e.Reset.Local().Format("15:04:05")
+	}
+	if e.Anonymous && e.Provider == "GitHub" {
+		message += " (set a token in api_keys.github, GITHUB_TOKEN or credentials.json for a higher limit)"
+	}
+	return message
+}
+
+// Providers known to be rate limited, so the rest of the run doesn't keep
+// asking an API that will refuse anyway
+var rateLimits = struct {
+	sync.Mutex
+	errors map[string]*RateLimitError
+}{errors: make(map[string]*RateLimitError)}
+
+// Get the recorded rate limit of a provider if it hasn't reset yet
+func activeRateLimit(provider string) *RateLimitError {
+	rateLimits.Lock()
+	defer rateLimits.Unlock()
+
+	limit := rateLimits.errors[provider]
+	if limit == nil || (!limit.Reset.IsZero() && time.Now().After(limit.Reset)) {
+		delete(rateLimits.errors, provider)
+		return nil
+	}
+	return limit
+}
+
+func recordRateLimit(limit *RateLimitError) {
+	rateLimits.Lock()
+	rateLimits.errors[limit.Provider] = limit
+	rateLimits.Unlock()
+}
+
+// Read the rate limit headers of a response. Returns nil if the request wasn't
+// limited, otherwise the error and how long to wait before retrying, which is
+// zero when the limit lasts too long to wait for.
+func checkRateLimit(provider string, resp *http.Response, anonymous bool) (*RateLimitError, time.Duration) {
+	remaining := firstHeader(resp, "X-RateLimit-Remaining", "RateLimit-Remaining")
+	reset := parseUnixTime(firstHeader(resp, "X-RateLimit-Reset", "RateLimit-Reset"))
+	retryAfter := resp.Header.Get("Retry-After")
+
+	limited := resp.StatusCode == http.StatusTooManyRequests ||
+		(resp.StatusCode == http.StatusForbidden && (remaining == "0" || retryAfter != ""))
+	if !limited {
+		// Out of requests after this one, later calls would only be refused
+		if remaining == "0" && !reset.IsZero() {
+			recordRateLimit(&RateLimitError{Provider: provider, Reset: reset, Anonymous: anonymous})
+		}
+		return nil, 0
+	}
+
+	limit := &RateLimitError{Provider: provider, Reset: reset, Anonymous: anonymous}
+
+	// Secondary limits ask for a short pause
+	if seconds, err := strconv.Atoi(retryAfter); err == nil {
+		wait := time.Duration(seconds) * time.Second
+		limit.Reset = time.Now().Add(wait)
+		if wait <= maxRateLimitWait {
+			return limit, wait
+		}
+	} else if !reset.IsZero() {
+		if wait := time.Until(reset); wait <= maxRateLimitWait {
+			return limit, wait + time.Second
+		}
+	}
+
+	recordRateLimit(limit)
+	return limit, 0
+}
+
+func firstHeader(resp *http.Response, names ...string) string {
+	for _, name := range names {
+		if value := resp.Header.Get(name); value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+func parseUnixTime(value string) time.Time {
+	seconds, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return time.Time{}
+	}
+	return time.Unix(seconds, 0)
+}
@@ -0,0 +1,673 @@
+package main
+
+import (
+	"archive/zip"
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// BackupInfo describes a full backup of an installation, either a zip file
+// or a snapshot in the deduplicated store
+type BackupInfo struct {
+	Name     string
+	Path     string
+	Time     time.Time
+	Size     int64
+	Snapshot bool
+	Sequence int // Counts backups taken within the same second
+}
+
+// List the full backups of an installation, newest first
+func listFullBackups(backupDir, installName string) []BackupInfo {
+	prefix := sanitizeFilename(installName) + "-full-"
+
+	var backups []BackupInfo
+	scan := func(dir, ext string, snapshot bool) {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return
+		}
+
+		for _, entry := range entries {
+			name := entry.Name()
+			if entry.IsDir() || !strings.HasPrefix(name, prefix) || !strings.HasSuffix(name, ext) {
+				continue
+			}
+
+			stamp := strings.TrimSuffix(strings.TrimPrefix(name, prefix), ext)
+			sequence := 1
+			if len(stamp) > len(backupTimestampFormat) && stamp[len(backupTimestampFormat)] == '-' {
+				if sequence, err = strconv.Atoi(stamp[len(backupTimestampFormat)+1:]); err != nil {
+					continue
+				}
+				stamp = stamp[:len(backupTimestampFormat)]
+			}
+			timestamp, err := time.ParseInLocation(backupTimestampFormat, stamp, time.Local)
+			if err != nil {
+				continue
+			}
+
+			info, err := entry.Info()
+			if err != nil {
+				continue
+			}
+
+			backup := BackupInfo{
+				Name:     name,
+				Path:     filepath.Join(dir, name),
+				Time:     timestamp,
+				Size:     info.Size(),
+				Snapshot: snapshot,
+				Sequence: sequence,
+			}
+
+			// A snapshot costs the objects it added to the store
+			if snapshot {
+				if contents, err := loadSnapshot(backup.Path); err == nil {
+					backup.Size += contents.AddedSize
+				}
+			}
+
+			backups = append(backups, backup)
+		}
+	}
+
+	scan(backupDir, ".zip", false)
+	scan(snapshotDirectory(backupDir), ".json", true)
+
+	sort.Slice(backups, func(i, j int) bool {
+		if !backups[i].Time.Equal(backups[j].Time) {
+			return backups[i].Time.After(backups[j].Time)
+		}
+		return backups[i].Sequence > backups[j].Sequence
+	})
+	return backups
+}
+
+// backupEntry is one file of a zip backup or store snapshot
+type backupEntry struct {
+	Name     string
+	Modified time.Time
+	Open     func() (io.ReadCloser, error)
+}
+
+// Read the file list of a backup. The returned close function must be called
+// once the entries are no longer needed.
+func readBackupEntries(backup BackupInfo) ([]backupEntry, func(), error) {
+	if backup.Snapshot {
+		entries, err := snapshotEntries(backup)
+		return entries, func() {}, err
+	}
+
+	reader, err := zip.OpenReader(backup.Path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var entries []backupEntry
+	for _, file := range reader.File {
+		if file.FileInfo().IsDir() {
+			continue
+		}
+		entries = append(entries, backupEntry{Name: file.Name, Modified: file.Modified, Open: file.Open})
+	}
+	return entries, func() { reader.Close() }, nil
+}
+
+// RestoreSelection picks what to bring back from a backup
+type RestoreSelection struct {
+	All      bool     // Every addon folder and the settings
+	Folders  []string // Addon folders to restore
+	Settings bool     // WTF account and character settings
+}
+
+// Get the top-level addon folders stored in a backup and whether it has settings
+func readBackupContents(backup BackupInfo) ([]string, bool, error) {
+	entries, closeBackup, err := readBackupEntries(backup)
+	if err != nil {
+		return nil, false, err
+	}
+	defer closeBackup()
+
+	seen := make(map[string]bool)
+	var folders []string
+	hasSettings := false
+	for _, entry := range entries {
+		folder := strings.SplitN(entry.Name, "/", 2)[0]
+		if folder == wtfBackupFolder {
+			hasSettings = true
+			continue
+		}
+		if folder != "" && !seen[folder] {
+			seen[folder] = true
+			folders = append(folders, folder)
+		}
+	}
+	sort.Strings(folders)
+	return folders, hasSettings, nil
+}
+
+func formatSize(size int64) string {
+	switch {
+	case size >= 1<<30:
+		return fmt.Sprintf("%.1f GB", float64(size)/(1<<30))
+	case size >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(size)/(1<<20))
+	case size >= 1<<10:
+		return fmt.Sprintf("%.1f KB", float64(size)/(1<<10))
+	}
+	return fmt.Sprintf("%d B", size)
+}
+
+// Restore addon folders and settings from a full backup. A safety backup of
+// the current state is taken first and its path returned.
+func restoreFromBackup(dir DirectoryConfig, backup BackupInfo, selection RestoreSelection) (string, error) {
+	available, hasSettings, err := readBackupContents(backup)
+	if err != nil {
+		return "", fmt.Errorf("failed to read backup: %v", err)
+	}
+
+	restoreSettings := selection.Settings || selection.All
+	wtfDir := findWTFDirectory(dir.Path)
+	if selection.Settings && !hasSettings {
+		return "", fmt.Errorf("backup %s has no WTF settings", backup.Name)
+	}
+	if restoreSettings && hasSettings && wtfDir == "" {
+		if selection.Settings {
+			return "", fmt.Errorf("no WTF directory found next to %s", dir.Path)
+		}
+		restoreSettings = false
+	}
+
+	// Resolve requested folders to their names in the backup
+	restoreSet := make(map[string]bool)
+	for _, folder := range selection.Folders {
+		found := false
+		for _, name := range available {
+			if strings.EqualFold(name, folder) {
+				restoreSet[name] = true
+				found = true
+				break
+			}
+		}
+		if !found {
+			return "", fmt.Errorf("folder '%s' not found in backup %s", folder, backup.Name)
+		}
+	}
+	restoreAll := selection.All
+	if restoreAll {
+		for _, name := range available {
+			restoreSet[name] = true
+		}
+	}
+
+	aggonDir := filepath.Join(filepath.Dir(dir.Path), "Aggon")
+	backupDir := filepath.Join(aggonDir, "Backups")
+	if err := setupAggonDirectories(aggonDir, backupDir, dir.Path); err != nil {
+		return "", fmt.Errorf("failed to setup Aggon directories: %v", err)
+	}
+
+	// Safety backup of the current state before anything is overwritten
+	safetyPath, err := createFullBackup(dir, backupDir)
+	if err != nil {
+		return "", fmt.Errorf("safety backup failed, nothing was restored: %v", err)
+	}
+
+	// Remove the folders being replaced. A full restore also removes backed up
+	// folders that didn't exist when the backup was taken.
+	var toRemove []string
+	if restoreAll {
+		current, err := getAddonDirectoriesToBackup(dir)
+		if err != nil {
+			return safetyPath, err
+		}
+		toRemove = current
+	} else {
+		for folder := range restoreSet {
+			toRemove = append(toRemove, filepath.Join(dir.Path, folder))
+		}
+	}
+	for _, path := range toRemove {
+		if err := os.RemoveAll(path); err != nil {
+			return safetyPath, fmt.Errorf("failed to remove %s: %v", filepath.Base(path), err)
+		}
+	}
+
+	if err := extractBackupFolders(backup, dir.Path, restoreSet); err != nil {
+		return safetyPath, fmt.Errorf("failed to restore files: %v", err)
+	}
+
+	// Settings are restored over the existing WTF directory, keeping files
+	// the backup doesn't have, like settings of characters created since
+	if restoreSettings && hasSettings {
+		if err := extractBackupSettings(backup, wtfDir); err != nil {
+			return safetyPath, fmt.Errorf("failed to restore settings: %v", err)
+		}
+	}
+
+	// Bring install records in line with what is now on disk
+	restored := make(map[string]bool)
+	for _, path := range toRemove {
+		restored[filepath.Base(path)] = true
+	}
+	for folder := range restoreSet {
+		restored[folder] = true
+	}
+	manifest := loadManifest(aggonDir)
+	rescanManifest(manifest, dir.Path, restored, backup.Name)
+	if err := saveManifest(aggonDir, manifest); err != nil {
+		return safetyPath, fmt.Errorf("failed to save install manifest: %v", err)
+	}
+
+	return safetyPath, nil
+}
+
+func extractBackupFolders(backup BackupInfo, dest string, folders map[string]bool) error {
+	return extractBackupFiles(backup, func(name string) (string, error) {
+		if !folders[strings.SplitN(name, "/", 2)[0]] {
+			return "", nil
+		}
+		return containedPath(dest, name)
+	})
+}
+
+func extractBackupSettings(backup BackupInfo, wtfDir string) error {
+	return extractBackupFiles(backup, func(name string) (string, error) {
+		relPath, found := strings.CutPrefix(name, wtfBackupFolder+"/")
+		if !found {
+			return "", nil
+		}
+		return containedPath(wtfDir, relPath)
+	})
+}
+
+// Extract backup files to the paths target maps them to, skipping files it
+// maps to "". Names are cleaned first and unsafe ones fail the restore, a
+// backup climbing out with ".." has been tampered with.
+func extractBackupFiles(backup BackupInfo, target func(name string) (string, error)) error {
+	entries, closeBackup, err := readBackupEntries(backup)
+	if err != nil {
+		return err
+	}
+	defer closeBackup()
+
+	// Check every name before anything is written
+	names := make([]string, len(entries))
+	for i, entry := range entries {
+		if names[i], err = sanitizeArchivePath(entry.Name); err != nil {
+			return err
+		}
+	}
+
+	for i, entry := range entries {
+		if names[i] == "" {
+			continue
+		}
+		destPath, err := target(names[i])
+		if err != nil {
+			return err
+		}
+		if destPath == "" {
+			continue
+		}
+
+		if err := os.MkdirAll(filepath.Dir(destPath), 0755); err != nil {
+			return err
+		}
+
+		rc, err := entry.Open()
+		if err != nil {
+			return err
+		}
+
+		outFile, err := os.Create(destPath)
+		if err != nil {
+			rc.Close()
+			return err
+		}
+
+		_, err = io.Copy(outFile, rc)
+		outFile.Close()
+		rc.Close()
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Write any backup as a plain zip file
+func exportBackupZip(backup BackupInfo, outPath string) error {
+	entries, closeBackup, err := readBackupEntries(backup)
+	if err != nil {
+		return err
+	}
+	defer closeBackup()
+
+	out, err := os.OpenFile(outPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+
+	zipWriter := zip.NewWriter(out)
+	for _, entry := range entries {
+		err = copyEntryToZip(zipWriter, entry)
+		if err != nil {
+			break
+		}
+	}
+	if closeErr := zipWriter.Close(); err == nil {
+		err = closeErr
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(outPath)
+	}
+	return err
+}
+
+func copyEntryToZip(zipWriter *zip.Writer, entry backupEntry) error {
+	rc, err := entry.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	writer, err := zipWriter.CreateHeader(&zip.FileHeader{
+		Name:     entry.Name,
+		Method:   zip.Deflate,
+		Modified: entry.Modified,
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(writer, rc)
+	return err
+}
+
+// Find a backup by file name, list number or "latest"
+func findBackup(backups []BackupInfo, selector string) (BackupInfo, error) {
+	if len(backups) == 0 {
+		return BackupInfo{}, fmt.Errorf("no backups found")
+	}
+	if selector == "" || selector == "latest" {
+		return backups[0], nil
+	}
+	if index, err := strconv.Atoi(selector); err == nil {
+		if index < 1 || index > len(backups) {
+			return BackupInfo{}, fmt.Errorf("backup number must be between 1 and %d", len(backups))
+		}
+		return backups[index-1], nil
+	}
+	for _, backup := range backups {
+		if backup.Name == selector || backup.Name == selector+".zip" {
+			return backup, nil
+		}
+	}
+	return BackupInfo{}, fmt.Errorf("backup '%s' not found", selector)
+}
+
+// Expand configured addon names to their installed folders, leaving folder names as given
+func resolveRestoreFolders(dir DirectoryConfig, names []string) []string {
+	aggonDir := filepath.Join(filepath.Dir(dir.Path), "Aggon")
+	manifest := loadManifest(aggonDir)
+
+	var folders []string
+	for _, name := range names {
+		matched := filterAddons(dir.Addons, []string{name})
+		if len(matched) == 0 {
+			folders = append(folders, name)
+			continue
+		}
+
+		addon := matched[0]
+		if entry, exists := manifest[addon.Name]; exists && len(entry.Folders) > 0 {
+			folders = append(folders, entry.Folders...)
+		} else if addon.Folder != "" {
+			folders = append(folders, addon.Folder)
+		} else {
+			folders = append(folders, addon.Name)
+		}
+	}
+	return folders
+}
+
+func printBackupList(dir DirectoryConfig, backups []BackupInfo) {
+	fmt.Printf("📂 %s\n", dir.Name)
+	if len(backups) == 0 {
+		fmt.Println("   No backups found")
+		return
+	}
+	for i, backup := range backups {
+		fmt.Printf("   %d. %s  %s  (%s)\n", i+1, backup.Time.Format("2006-01-02 15:04:05"), backup.Name, formatSize(backup.Size))
+	}
+}
+
+func installationBackups(dir DirectoryConfig) []BackupInfo {
+	backupDir := filepath.Join(filepath.Dir(dir.Path), "Aggon", "Backups")
+	return listFullBackups(backupDir, dir.Name)
+}
+
+func runRestoreCommand(args []string) int {
+	fs := flag.NewFlagSet("restore", flag.ContinueOnError)
+	var dirNames stringList
+	fs.Var(&dirNames, "dir", "installation to restore")
+	list := fs.Bool("list", false, "list available backups")
+	settings := fs.Bool("settings", false, "restore WTF settings")
+	backupName := fs.String("backup", "latest", "backup file name, list number or 'latest'")
+
+	names, err := parseInterspersed(fs, args)
+	if err != nil {
+		return exitUsage
+	}
+
+	config, err := loadCommandConfig(dirNames)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return exitUsage
+	}
+
+	if *list {
+		for _, dir := range config {
+			printBackupList(dir, installationBackups(dir))
+			fmt.Println()
+		}
+		return exitOK
+	}
+
+	if len(config) != 1 {
+		fmt.Println("Error: choose one installation with --dir")
+		return exitUsage
+	}
+	dir := config[0]
+
+	backup, err := findBackup(installationBackups(dir), *backupName)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return exitUsage
+	}
+
+	selection := RestoreSelection{
+		All:      len(names) == 0 && !*settings,
+		Folders:  resolveRestoreFolders(dir, names),
+		Settings: *settings,
+	}
+	return reportRestore(dir, backup, selection)
+}
+
+func runExportCommand(args []string) int {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	var dirNames stringList
+	fs.Var(&dirNames, "dir", "installation to export from")
+	backupName := fs.String("backup", "latest", "backup file name, list number or 'latest'")
+	outPath := fs.String("out", "", "zip file to write (default: backup name in the current directory)")
+
+	if _, err := parseInterspersed(fs, args); err != nil {
+		return exitUsage
+	}
+
+	config, err := loadCommandConfig(dirNames)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return exitUsage
+	}
+	if len(config) != 1 {
+		fmt.Println("Error: choose one installation with --dir")
+		return exitUsage
+	}
+
+	backup, err := findBackup(installationBackups(config[0]), *backupName)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return exitUsage
+	}
+
+	out := *outPath
+	if out == "" {
+		out = strings.TrimSuffix(backup.Name, filepath.Ext(backup.Name)) + ".zip"
+	}
+
+	if err := exportBackupZip(backup, out); err != nil {
+		fmt.Printf("❌ Export failed: %v\n", err)
+		return exitFailure
+	}
+
+	fmt.Printf("✅ Exported %s to %s\n", backup.Name, out)
+	return exitOK
+}
+
+func reportRestore(dir DirectoryConfig, backup BackupInfo, selection RestoreSelection) int {
+	var parts []string
+	if selection.All {
+		parts = append(parts, "all addon folders and settings")
+	}
+	if len(selection.Folders) > 0 {
+		parts = append(parts, strings.Join(selection.Folders, ", "))
+	}
+	if selection.Settings {
+		parts = append(parts, "WTF settings")
+	}
+	fmt.Printf("♻️  Restoring %s from %s...\n", strings.Join(parts, " and "), backup.Name)
+
+	safetyPath, err := restoreFromBackup(dir, backup, selection)
+	if safetyPath != "" {
+		fmt.Printf("💾 Safety backup: %s\n", filepath.Base(safetyPath))
+	}
+	if err != nil {
+		fmt.Printf("❌ Restore failed: %v\n", err)
+		return exitFailure
+	}
+
+	fmt.Println("✅ Restore completed successfully")
+	return exitOK
+}
+
+func runRestoreWizard(config Config) error {
+	if len(config) == 0 {
+		return fmt.Errorf("no installation directories found in config")
+	}
+
+	reader := bufio.NewReader(os.Stdin)
+
+	fmt.Println("♻️  Restore From Backup")
+	fmt.Println("======================")
+	fmt.Println()
+
+	// Select directory
+	fmt.Println("Select installation:")
+	for i, dir := range config {
+		fmt.Printf("%d. %s (%s)\n", i+1, dir.Name, dir.Path)
+	}
+	fmt.Print("Choose installation (1-" + strconv.Itoa(len(config)) + "): ")
+
+	input, _ := reader.ReadString('\n')
+	selectedIndex, err := strconv.Atoi(strings.TrimSpace(input))
+	if err != nil || selectedIndex < 1 || selectedIndex > len(config) {
+		return fmt.Errorf("invalid installation selection")
+	}
+	dir := config[selectedIndex-1]
+
+	// Select backup
+	fmt.Println()
+	backups := installationBackups(dir)
+	printBackupList(dir, backups)
+	if len(backups) == 0 {
+		return nil
+	}
+	fmt.Print("Choose backup (1-" + strconv.Itoa(len(backups)) + "): ")
+
+	input, _ = reader.ReadString('\n')
+	backup, err := findBackup(backups, strings.TrimSpace(input))
+	if err != nil {
+		return err
+	}
+
+	// Select what to restore
+	available, hasSettings, err := readBackupContents(backup)
+	if err != nil {
+		return fmt.Errorf("failed to read backup: %v", err)
+	}
+	fmt.Println()
+	fmt.Printf("Backup contains %d folders: %s\n", len(available), strings.Join(available, ", "))
+	if hasSettings {
+		fmt.Println("Backup contains WTF settings")
+	}
+	fmt.Println()
+	fmt.Println("1. Everything")
+	fmt.Println("2. Selected addons or folders")
+	if hasSettings {
+		fmt.Println("3. Settings only (WTF SavedVariables)")
+	}
+	fmt.Print("Choose what to restore: ")
+
+	input, _ = reader.ReadString('\n')
+	var selection RestoreSelection
+	switch strings.TrimSpace(input) {
+	case "1":
+		selection.All = true
+	case "2":
+		fmt.Print("Addons or folders to restore (comma-separated): ")
+		input, _ = reader.ReadString('\n')
+		var names []string
+		for _, name := range strings.Split(input, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				names = append(names, name)
+			}
+		}
+		if len(names) == 0 {
+			return fmt.Errorf("no addons or folders given")
+		}
+		selection.Folders = resolveRestoreFolders(dir, names)
+	case "3":
+		if !hasSettings {
+			return fmt.Errorf("invalid choice")
+		}
+		selection.Settings = true
+	default:
+		return fmt.Errorf("invalid choice")
+	}
+
+	fmt.Print("A safety backup will be taken first. Continue? (y/N): ")
+	input, _ = reader.ReadString('\n')
+	if strings.ToLower(strings.TrimSpace(input)) != "y" {
+		fmt.Println("Restore cancelled")
+		return nil
+	}
+
+	fmt.Println()
+	reportRestore(dir, backup, selection)
+	return nil
+}
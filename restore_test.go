@@ -0,0 +1,110 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// Set up an installation with one addon folder, returning its config and backup folder
+func testInstallation(t *testing.T, format string) (DirectoryConfig, string) {
+	t.Helper()
+	root := t.TempDir()
+	dir := DirectoryConfig{Name: "Test", Path: filepath.Join(root, "Interface", "AddOns"), BackupFormat: format}
+	if err := os.MkdirAll(filepath.Join(dir.Path, "MyAddon"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir.Path, "MyAddon", "MyAddon.toc"), []byte("## Version: 1.0\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	backupDir := filepath.Join(root, "Interface", "Aggon", "Backups")
+	if err := os.MkdirAll(snapshotDirectory(backupDir), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return dir, backupDir
+}
+
+func TestBackupsWithinTheSameSecond(t *testing.T) {
+	for _, format := range []string{backupFormatZip, backupFormatStore} {
+		dir, backupDir := testInstallation(t, format)
+
+		var paths []string
+		for i := 0; i < 3; i++ {
+			path, err := createFullBackup(dir, backupDir)
+			if err != nil {
+				t.Fatalf("%s backup %d: %v", format, i+1, err)
+			}
+			paths = append(paths, path)
+		}
+		if paths[0] == paths[1] || paths[1] == paths[2] || paths[0] == paths[2] {
+			t.Fatalf("%s: backups share a name: %v", format, paths)
+		}
+
+		backups := listFullBackups(backupDir, dir.Name)
+		if len(backups) != 3 {
+			t.Fatalf("%s: listed %d backups, want 3", format, len(backups))
+		}
+		if backups[0].Path != paths[2] {
+			t.Errorf("%s: newest listed is %s, want %s", format, backups[0].Name, filepath.Base(paths[2]))
+		}
+	}
+}
+
+func TestCreateBackupFileAddsSequence(t *testing.T) {
+	dir := t.TempDir()
+	created := time.Date(2024, 1, 1, 12, 0, 0, 0, time.Local)
+
+	var names []string
+	for i := 0; i < 3; i++ {
+		file, err := createBackupFile(dir, "MyWoW", ".zip", created)
+		if err != nil {
+			t.Fatal(err)
+		}
+		file.Close()
+		names = append(names, filepath.Base(file.Name()))
+	}
+
+	want := []string{"MyWoW-full-20240101-120000.zip", "MyWoW-full-20240101-120000-2.zip", "MyWoW-full-20240101-120000-3.zip"}
+	for i := range want {
+		if names[i] != want[i] {
+			t.Errorf("backup %d named %s, want %s", i+1, names[i], want[i])
+		}
+	}
+
+	backups := listFullBackups(dir, "MyWoW")
+	if len(backups) != 3 || backups[0].Name != want[2] || backups[2].Name != want[0] {
+		t.Errorf("listed %+v, want newest sequence first", backups)
+	}
+}
+
+func TestRestoreRightAfterBackup(t *testing.T) {
+	dir, backupDir := testInstallation(t, backupFormatZip)
+	backupPath, err := createFullBackup(dir, backupDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Take the names of the next seconds too, so the safety backup collides
+	now := time.Now()
+	for i := 0; i < 3; i++ {
+		file, err := createBackupFile(backupDir, dir.Name, ".zip", now.Add(time.Duration(i)*time.Second))
+		if err != nil {
+			t.Fatal(err)
+		}
+		file.Close()
+	}
+
+	if err := os.WriteFile(filepath.Join(dir.Path, "MyAddon", "MyAddon.toc"), []byte("## Version: 2.0\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	backup := BackupInfo{Name: filepath.Base(backupPath), Path: backupPath}
+	if _, err := restoreFromBackup(dir, backup, RestoreSelection{All: true}); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(filepath.Join(dir.Path, "MyAddon", "MyAddon.toc"))
+	if err != nil || string(data) != "## Version: 1.0\n" {
+		t.Errorf("restored %q, %v", data, err)
+	}
+}
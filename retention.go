@@ -0,0 +1,252 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RetentionPolicy decides which full backups of an installation are kept.
+// A backup is kept if any rule keeps it; the size limit then drops the oldest
+// kept backups until the rest fit. The newest backup is always kept.
+type RetentionPolicy struct {
+	KeepLast     int    `json:"keep_last,omitempty"`      // Most recent backups to keep
+	KeepDaily    int    `json:"keep_daily,omitempty"`     // Days to keep one backup per day for
+	KeepWeekly   int    `json:"keep_weekly,omitempty"`    // Weeks to keep one backup per week for
+	KeepMonthly  int    `json:"keep_monthly,omitempty"`   // Months to keep one backup per month for
+	MaxTotalSize string `json:"max_total_size,omitempty"` // Size limit for all backups, e.g. "2GB"
+}
+
+// Retention used when an installation doesn't configure one
+var defaultRetention = RetentionPolicy{KeepLast: 5}
+
+// PruneDecision records whether a backup is kept and why
+type PruneDecision struct {
+	Backup  BackupInfo
+	Keep    bool
+	Reasons []string
+}
+
+func (d *PruneDecision) keep(reason string) {
+	d.Keep = true
+	d.Reasons = append(d.Reasons, reason)
+}
+
+func retentionPolicy(dir DirectoryConfig) RetentionPolicy {
+	if dir.Retention == nil {
+		return defaultRetention
+	}
+	return *dir.Retention
+}
+
+// Parse sizes like "500MB", "2 GB" or plain bytes
+func parseSize(value string) (int64, error) {
+	value = strings.ToUpper(strings.TrimSpace(value))
+	units := []struct {
+		suffix string
+		size   int64
+	}{
+		{"TB", 1 << 40}, {"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10}, {"B", 1},
+	}
+
+	multiplier := int64(1)
+	for _, unit := range units {
+		if strings.HasSuffix(value, unit.suffix) {
+			multiplier = unit.size
+			value = strings.TrimSpace(strings.TrimSuffix(value, unit.suffix))
+			break
+		}
+	}
+
+	number, err := strconv.ParseFloat(value, 64)
+	if err != nil || number < 0 {
+		return 0, fmt.Errorf("invalid size '%s'", value)
+	}
+	return int64(number * float64(multiplier)), nil
+}
+
+// Decide which backups to keep. Backups must be sorted newest first.
+func planRetention(backups []BackupInfo, policy RetentionPolicy, now time.Time) ([]PruneDecision, error) {
+	decisions := make([]PruneDecision, len(backups))
+	for i, backup := range backups {
+		decisions[i].Backup = backup
+	}
+
+	for i := 0; i < len(decisions) && i < policy.KeepLast; i++ {
+		decisions[i].keep(fmt.Sprintf("one of the last %d", policy.KeepLast))
+	}
+
+	// Keep the newest backup of each period that falls inside the window
+	keepPeriods := func(since time.Time, label string, period func(time.Time) string) {
+		seen := make(map[string]bool)
+		for i := range decisions {
+			backupTime := decisions[i].Backup.Time
+			if backupTime.Before(since) {
+				break
+			}
+			key := period(backupTime)
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			decisions[i].keep(label + " " + key)
+		}
+	}
+
+	if policy.KeepDaily > 0 {
+		keepPeriods(now.AddDate(0, 0, -policy.KeepDaily), "daily", func(t time.Time) string {
+			return t.Format("2006-01-02")
+		})
+	}
+	if policy.KeepWeekly > 0 {
+		keepPeriods(now.AddDate(0, 0, -7*policy.KeepWeekly), "weekly", func(t time.Time) string {
+			year, week := t.ISOWeek()
+			return fmt.Sprintf("%d-W%02d", year, week)
+		})
+	}
+	if policy.KeepMonthly > 0 {
+		keepPeriods(now.AddDate(0, -policy.KeepMonthly, 0), "monthly", func(t time.Time) string {
+			return t.Format("2006-01")
+		})
+	}
+
+	if len(decisions) > 0 && !decisions[0].Keep {
+		decisions[0].keep("newest backup")
+	}
+
+	if policy.MaxTotalSize != "" {
+		maxSize, err := parseSize(policy.MaxTotalSize)
+		if err != nil {
+			return decisions, err
+		}
+
+		var total int64
+		for i := range decisions {
+			if !decisions[i].Keep {
+				continue
+			}
+			total += decisions[i].Backup.Size
+			if total > maxSize && i > 0 {
+				decisions[i].Keep = false
+				decisions[i].Reasons = []string{fmt.Sprintf("over the %s size limit", policy.MaxTotalSize)}
+			}
+		}
+	}
+
+	for i := range decisions {
+		if !decisions[i].Keep && len(decisions[i].Reasons) == 0 {
+			decisions[i].Reasons = []string{"not kept by any retention rule"}
+		}
+	}
+
+	return decisions, nil
+}
+
+// Apply the installation's retention policy, deleting backups it doesn't keep
+func pruneFullBackups(dir DirectoryConfig, backupDir string, dryRun bool) ([]PruneDecision, error) {
+	backups := listFullBackups(backupDir, dir.Name)
+	decisions, err := planRetention(backups, retentionPolicy(dir), time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	if dryRun {
+		return decisions, nil
+	}
+
+	removedSnapshot := false
+	for _, decision := range decisions {
+		if decision.Keep {
+			continue
+		}
+		if err := os.Remove(decision.Backup.Path); err != nil && !os.IsNotExist(err) {
+			return decisions, fmt.Errorf("failed to remove %s: %v", decision.Backup.Name, err)
+		}
+		removedSnapshot = removedSnapshot || decision.Backup.Snapshot
+	}
+
+	// Drop file contents only the removed snapshots used
+	if removedSnapshot {
+		if _, _, err := collectStoreGarbage(backupDir); err != nil {
+			return decisions, fmt.Errorf("failed to clean up backup store: %v", err)
+		}
+	}
+	return decisions, nil
+}
+
+// Print removed backups, or every decision when verbose
+func printPruneDecisions(decisions []PruneDecision, indent string, verbose bool) {
+	for _, decision := range decisions {
+		reasons := strings.Join(decision.Reasons, ", ")
+		if decision.Keep {
+			if verbose {
+				fmt.Printf("%s📦 Keep   %s (%s)\n", indent, decision.Backup.Name, reasons)
+			}
+		} else {
+			fmt.Printf("%s🧹 Remove %s (%s)\n", indent, decision.Backup.Name, reasons)
+		}
+	}
+}
+
+func runPruneCommand(args []string) int {
+	fs := flag.NewFlagSet("prune", flag.ContinueOnError)
+	var dirNames stringList
+	fs.Var(&dirNames, "dir", "only prune this installation (repeatable)")
+	dryRun := fs.Bool("dry-run", false, "show decisions without deleting anything")
+
+	if _, err := parseInterspersed(fs, args); err != nil {
+		return exitUsage
+	}
+
+	config, err := loadCommandConfig(dirNames)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return exitUsage
+	}
+
+	exitCode := exitOK
+	for _, dir := range config {
+		fmt.Printf("📂 %s\n", dir.Name)
+
+		backupDir := filepath.Join(filepath.Dir(dir.Path), "Aggon", "Backups")
+		decisions, err := pruneFullBackups(dir, backupDir, *dryRun)
+		printPruneDecisions(decisions, "   ", true)
+		if err != nil {
+			fmt.Printf("   ❌ %v\n", err)
+			exitCode = exitFailure
+		} else if len(decisions) == 0 {
+			fmt.Println("   No backups found")
+		}
+		fmt.Println()
+	}
+
+	return exitCode
+}
+
+// Format a retention policy as a single line of JSON for the config file
+func formatRetention(policy RetentionPolicy) string {
+	var fields []string
+	if policy.KeepLast > 0 {
+		fields = append(fields, fmt.Sprintf("\"keep_last\": %d", policy.KeepLast))
+	}
+	if policy.KeepDaily > 0 {
+		fields = append(fields, fmt.Sprintf("\"keep_daily\": %d", policy.KeepDaily))
+	}
+	if policy.KeepWeekly > 0 {
+		fields = append(fields, fmt.Sprintf("\"keep_weekly\": %d", policy.KeepWeekly))
+	}
+	if policy.KeepMonthly > 0 {
+		fields = append(fields, fmt.Sprintf("\"keep_monthly\": %d", policy.KeepMonthly))
+	}
+	if policy.MaxTotalSize != "" {
+		fields = append(fields, fmt.Sprintf("\"max_total_size\": %q", policy.MaxTotalSize))
+	}
+	if len(fields) == 0 {
+		return "{}"
+	}
+	return "{ " + strings.Join(fields, ", ") + " }"
+}
@@ -0,0 +1,282 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Game flavors and how each addon site names them
+type gameFlavor struct {
+	curseForgeType int    // CurseForge gameVersionTypeId
+	wagoVersion    string // Wago game_version
+}
+
+var gameFlavors = map[string]gameFlavor{
+	"retail":  {curseForgeType: 517, wagoVersion: "retail"},
+	"classic": {curseForgeType: 67408, wagoVersion: "classic"},
+	"tbc":     {curseForgeType: 73246, wagoVersion: "bc"},
+	"wotlk":   {curseForgeType: 73713, wagoVersion: "wotlk"},
+	"cata":    {curseForgeType: 77522, wagoVersion: "cata"},
+}
+
+const defaultFlavor = "retail"
+
+// Release types from most to least stable. Choosing one also allows the more
+// stable ones, so "beta" takes a release if it is newer than the latest beta.
+// Release channels of repository sources use the same levels.
+const (
+	releaseTypeRelease = 1
+	releaseTypeBeta    = 2
+	releaseTypeAlpha   = 3
+)
+
+var channelNames = map[int]string{
+	releaseTypeRelease: "stable",
+	releaseTypeBeta:    "beta",
+	releaseTypeAlpha:   "alpha",
+}
+
+// Default API addresses, "base_url" replaces them (e.g. for a mirror)
+var siteAPIURLs = map[string]string{
+	providerCurseForge:   "https://api.curseforge.com",
+	providerWago:         "https://addons.wago.io/api/external",
+	providerWoWInterface: "https://api.mmoui.com/v3/game/WOW",
+}
+
+// AddonSite resolves downloads from an addon hosting site rather than a repository
+type AddonSite interface {
+	// Download URL of the newest file for a flavor, at most as unstable as releaseType
+	latestFileURL(flavor gameFlavor, releaseType int) (string, error)
+}
+
+// Get the addon site an addon is published on, if it isn't a repository
+func addonSiteFor(addon AddonConfig) (AddonSite, bool) {
+	provider := addonProvider(addon)
+	apiURL, isSite := siteAPIURLs[provider]
+	if !isSite {
+		return nil, false
+	}
+	if addon.BaseURL != "" {
+		apiURL = strings.TrimSuffix(addon.BaseURL, "/")
+	}
+
+	switch provider {
+	case providerCurseForge:
+		return curseForgeSite{apiURL: apiURL, apiKey: addon.APIKey, project: siteProject(addon)}, true
+	case providerWago:
+		return wagoSite{apiURL: apiURL, apiKey: addon.APIKey, project: siteProject(addon)}, true
+	default:
+		return wowInterfaceSite{apiURL: apiURL, project: siteProject(addon)}, true
+	}
+}
+
+// Project ID as configured, or the project's slug or ID taken from its page URL
+func siteProject(addon AddonConfig) string {
+	if addon.ProjectID != "" {
+		return addon.ProjectID
+	}
+
+	parsed, err := url.Parse(strings.TrimSuffix(addon.URL, "/"))
+	if err != nil {
+		return ""
+	}
+	parts := strings.Split(strings.Trim(parsed.Path, "/"), "/")
+	return parts[len(parts)-1]
+}
+
+// Resolve the download URL of the newest allowed file on an addon site
+func getSiteDownloadURL(addon AddonConfig, site AddonSite) (string, error) {
+	flavorName := strings.ToLower(addon.Flavor)
+	if flavorName == "" {
+		flavorName = defaultFlavor
+	}
+	flavor, exists := gameFlavors[flavorName]
+	if !exists {
+		return "", fmt.Errorf("unknown flavor '%s'", addon.Flavor)
+	}
+
+	// An explicit release_type wins over the addon's channel
+	releaseType, err := parseChannel(addon.Channel)
+	if addon.ReleaseType != "" {
+		releaseType, err = parseReleaseType(addon.ReleaseType)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	downloadURL, err := site.latestFileURL(flavor, releaseType)
+	if err != nil {
+		return "", fmt.Errorf("failed to get latest file: %w", err)
+	}
+	return downloadURL, nil
+}
+
+func parseReleaseType(value string) (int, error) {
+	switch strings.ToLower(value) {
+	case "", "release", "stable":
+		return releaseTypeRelease, nil
+	case "beta":
+		return releaseTypeBeta, nil
+	case "alpha":
+		return releaseTypeAlpha, nil
+	}
+	return 0, fmt.Errorf("unknown release_type '%s', use release, beta or alpha", value)
+}
+
+func parseChannel(value string) (int, error) {
+	channel, err := parseReleaseType(value)
+	if err != nil {
+		return 0, fmt.Errorf("unknown channel '%s', use stable, beta or alpha", value)
+	}
+	return channel, nil
+}
+
+type curseForgeSite struct {
+	apiURL, apiKey, project string
+}
+
+// CurseForgeFile is a file as returned by the CurseForge API
+type CurseForgeFile struct {
+	ID          int       `json:"id"`
+	FileName    string    `json:"fileName"`
+	ReleaseType int       `json:"releaseType"`
+	FileDate    time.Time `json:"fileDate"`
+	DownloadURL string    `json:"downloadUrl"`
+	IsAvailable bool      `json:"isAvailable"`
+}
+
+func (s curseForgeSite) latestFileURL(flavor gameFlavor, releaseType int) (string, error) {
+	if s.apiKey == "" {
+		return "", fmt.Errorf("CurseForge needs an API key, set api_keys.curseforge, %s or credentials.json", apiKeyEnvironment[providerCurseForge][0])
+	}
+	headers := map[string]string{"x-api-key": s.apiKey}
+
+	modID, err := s.modID(headers)
+	if err != nil {
+		return "", err
+	}
+
+	var files struct {
+		Data []CurseForgeFile `json:"data"`
+	}
+	apiURL := fmt.Sprintf("%s/v1/mods/%d/files?gameVersionTypeId=%d&pageSize=50", s.apiURL, modID, flavor.curseForgeType)
+	if err := fetchJSON(apiURL, "CurseForge", headers, &files); err != nil {
+		return "", err
+	}
+
+	sort.Slice(files.Data, func(i, j int) bool {
+		return files.Data[i].FileDate.After(files.Data[j].FileDate)
+	})
+
+	for _, file := range files.Data {
+		if !file.IsAvailable || file.ReleaseType > releaseType {
+			continue
+		}
+
+		// Authors can disable API downloads, the CDN still serves the file
+		downloadURL := file.DownloadURL
+		if downloadURL == "" {
+			downloadURL = fmt.Sprintf("https://edge.forgecdn.net/files/%d/%d/%s", file.ID/1000, file.ID%1000, url.PathEscape(file.FileName))
+		}
+		return downloadURL, nil
+	}
+	return "", fmt.Errorf("no matching files found")
+}
+
+// Numeric mod ID, looked up by slug when the project isn't given as a number
+func (s curseForgeSite) modID(headers map[string]string) (int, error) {
+	if id, err := strconv.Atoi(s.project); err == nil {
+		return id, nil
+	}
+
+	var search struct {
+		Data []struct {
+			ID   int    `json:"id"`
+			Slug string `json:"slug"`
+		} `json:"data"`
+	}
+	apiURL := fmt.Sprintf("%s/v1/mods/search?gameId=1&slug=%s", s.apiURL, url.QueryEscape(s.project))
+	if err := fetchJSON(apiURL, "CurseForge", headers, &search); err != nil {
+		return 0, err
+	}
+	for _, mod := range search.Data {
+		if strings.EqualFold(mod.Slug, s.project) {
+			return mod.ID, nil
+		}
+	}
+	return 0, fmt.Errorf("no CurseForge project '%s' found", s.project)
+}
+
+type wagoSite struct {
+	apiURL, apiKey, project string
+}
+
+// WagoRelease is one release channel of an addon as returned by the Wago API
+type WagoRelease struct {
+	DownloadLink string `json:"download_link"`
+	CreatedAt    string `json:"created_at"`
+}
+
+func (s wagoSite) latestFileURL(flavor gameFlavor, releaseType int) (string, error) {
+	if s.apiKey == "" {
+		return "", fmt.Errorf("Wago needs an API key, set api_keys.wago, %s or credentials.json", apiKeyEnvironment[providerWago][0])
+	}
+
+	var addon struct {
+		RecentRelease map[string]*WagoRelease `json:"recent_release"`
+	}
+	apiURL := fmt.Sprintf("%s/addons/%s?game_version=%s", s.apiURL, url.PathEscape(s.project), flavor.wagoVersion)
+	headers := map[string]string{"Authorization": "Bearer " + s.apiKey}
+	if err := fetchJSON(apiURL, "Wago", headers, &addon); err != nil {
+		return "", err
+	}
+
+	// Newest release among the allowed channels
+	var newest *WagoRelease
+	for i, channel := range []string{"stable", "beta", "alpha"} {
+		release := addon.RecentRelease[channel]
+		if i+1 > releaseType || release == nil || release.DownloadLink == "" {
+			continue
+		}
+		if newest == nil || release.CreatedAt > newest.CreatedAt {
+			newest = release
+		}
+	}
+	if newest == nil {
+		return "", fmt.Errorf("no matching files found")
+	}
+	return newest.DownloadLink, nil
+}
+
+type wowInterfaceSite struct {
+	apiURL, project string
+}
+
+// WoWInterface page URLs look like /downloads/info5108-Clique.html
+var wowInterfaceIDPattern = regexp.MustCompile(`^(?:info)?(\d+)`)
+
+func (s wowInterfaceSite) latestFileURL(flavor gameFlavor, releaseType int) (string, error) {
+	// WoWInterface publishes a single current file per addon, so flavor and
+	// release type don't narrow anything down
+	match := wowInterfaceIDPattern.FindStringSubmatch(s.project)
+	if match == nil {
+		return "", fmt.Errorf("no WoWInterface file ID in '%s'", s.project)
+	}
+
+	var details []struct {
+		Download string `json:"UIDownload"`
+	}
+	apiURL := fmt.Sprintf("%s/filedetails/%s.json", s.apiURL, match[1])
+	if err := fetchJSON(apiURL, "WoWInterface", nil, &details); err != nil {
+		return "", err
+	}
+	if len(details) == 0 || details[0].Download == "" {
+		return "", fmt.Errorf("no files found")
+	}
+	return details[0].Download, nil
+}
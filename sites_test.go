@@ -0,0 +1,321 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Serve JSON responses and files by request path, recording the last API
+// request. Files carry an ETag and are counted when actually sent.
+type siteServer struct {
+	*httptest.Server
+	responses map[string]func(r *http.Request) interface{}
+	files     map[string][]byte
+	downloads int
+	last      *http.Request
+}
+
+func newSiteServer(t *testing.T) *siteServer {
+	s := &siteServer{responses: make(map[string]func(r *http.Request) interface{}), files: make(map[string][]byte)}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if data, exists := s.files[r.URL.Path]; exists {
+			etag := fmt.Sprintf(`"%x"`, sha256.Sum256(data))
+			if r.Header.Get("If-None-Match") == etag {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			s.downloads++
+			w.Header().Set("ETag", etag)
+			w.Write(data)
+			return
+		}
+
+		s.last = r
+		respond, exists := s.responses[r.URL.Path]
+		if !exists {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(respond(r))
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func curseForgeServer(t *testing.T) *siteServer {
+	s := newSiteServer(t)
+	s.responses["/v1/mods/search"] = func(r *http.Request) interface{} {
+		return map[string]interface{}{"data": []map[string]interface{}{{"id": 42, "slug": r.URL.Query().Get("slug")}}}
+	}
+	s.responses["/v1/mods/42/files"] = func(r *http.Request) interface{} {
+		flavor := r.URL.Query().Get("gameVersionTypeId")
+		file := func(id, releaseType int, date string, available bool) map[string]interface{} {
+			return map[string]interface{}{
+				"id":          id,
+				"fileName":    "Details.zip",
+				"releaseType": releaseType,
+				"fileDate":    date,
+				"downloadUrl": s.URL + "/files/" + flavor + "/" + map[int]string{1: "release", 2: "beta", 3: "alpha"}[releaseType] + ".zip",
+				"isAvailable": available,
+			}
+		}
+		return map[string]interface{}{"data": []map[string]interface{}{
+			file(1, 1, "2024-01-01T00:00:00Z", true),
+			file(2, 2, "2024-02-01T00:00:00Z", true),
+			file(3, 3, "2024-03-01T00:00:00Z", true),
+			file(4, 1, "2024-04-01T00:00:00Z", false),
+		}}
+	}
+	return s
+}
+
+func TestCurseForgeFileSelection(t *testing.T) {
+	server := curseForgeServer(t)
+
+	tests := []struct {
+		flavor, releaseType, channel string
+		want                         string
+	}{
+		{"", "", "", "/files/517/release.zip"},
+		{"classic", "", "", "/files/67408/release.zip"},
+		{"wotlk", "beta", "", "/files/73713/beta.zip"},
+		{"", "alpha", "", "/files/517/alpha.zip"},
+		{"", "", "beta", "/files/517/beta.zip"},
+		{"", "release", "alpha", "/files/517/release.zip"},
+	}
+	for _, test := range tests {
+		addon := AddonConfig{
+			Name:        "Details",
+			URL:         "https://www.curseforge.com/wow/addons/details",
+			BaseURL:     server.URL,
+			Flavor:      test.flavor,
+			ReleaseType: test.releaseType,
+			Channel:     test.channel,
+			APIKey:      "key",
+		}
+		got, _, err := getDownloadURL(addon)
+		if err != nil {
+			t.Errorf("flavor %q release_type %q channel %q: %v", test.flavor, test.releaseType, test.channel, err)
+			continue
+		}
+		if got != server.URL+test.want {
+			t.Errorf("flavor %q release_type %q channel %q: got %s, want %s", test.flavor, test.releaseType, test.channel, got, server.URL+test.want)
+		}
+	}
+}
+
+func TestWagoFileSelection(t *testing.T) {
+	server := newSiteServer(t)
+	server.responses["/addons/details"] = func(r *http.Request) interface{} {
+		flavor := r.URL.Query().Get("game_version")
+		release := func(channel, date string) map[string]string {
+			return map[string]string{"download_link": server.URL + "/files/" + flavor + "/" + channel + ".zip", "created_at": date}
+		}
+		return map[string]interface{}{"recent_release": map[string]interface{}{
+			"stable": release("stable", "2024-03-01T00:00:00Z"),
+			"beta":   release("beta", "2024-02-01T00:00:00Z"),
+			"alpha":  release("alpha", "2024-04-01T00:00:00Z"),
+		}}
+	}
+
+	tests := []struct {
+		flavor, releaseType string
+		want                string
+	}{
+		{"", "", "/files/retail/stable.zip"},
+		{"tbc", "", "/files/bc/stable.zip"},
+		{"", "beta", "/files/retail/stable.zip"}, // Stable is newer than the latest beta
+		{"cata", "alpha", "/files/cata/alpha.zip"},
+	}
+	for _, test := range tests {
+		addon := AddonConfig{
+			Name:        "Details",
+			URL:         "https://addons.wago.io/addons/details",
+			BaseURL:     server.URL,
+			Flavor:      test.flavor,
+			ReleaseType: test.releaseType,
+			APIKey:      "key",
+		}
+		got, _, err := getDownloadURL(addon)
+		if err != nil {
+			t.Errorf("flavor %q release_type %q: %v", test.flavor, test.releaseType, err)
+			continue
+		}
+		if got != server.URL+test.want {
+			t.Errorf("flavor %q release_type %q: got %s, want %s", test.flavor, test.releaseType, got, server.URL+test.want)
+		}
+	}
+}
+
+func TestWoWInterfaceDownload(t *testing.T) {
+	server := newSiteServer(t)
+	server.responses["/filedetails/5108.json"] = func(r *http.Request) interface{} {
+		return []map[string]string{{"UIDownload": server.URL + "/files/clique.zip"}}
+	}
+
+	addon := AddonConfig{Name: "Clique", URL: "https://www.wowinterface.com/downloads/info5108-Clique.html", BaseURL: server.URL}
+	got, _, err := getDownloadURL(addon)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != server.URL+"/files/clique.zip" {
+		t.Errorf("got %s", got)
+	}
+}
+
+func TestSiteAPIKeys(t *testing.T) {
+	curseForge := curseForgeServer(t)
+	wago := newSiteServer(t)
+	wago.responses["/addons/details"] = func(r *http.Request) interface{} {
+		return map[string]interface{}{"recent_release": map[string]interface{}{
+			"stable": map[string]string{"download_link": wago.URL + "/files/details.zip", "created_at": "2024-01-01T00:00:00Z"},
+		}}
+	}
+
+	tests := []struct {
+		name    string
+		server  *siteServer
+		url     string
+		apiKeys map[string]string
+		env     map[string]string
+		header  string
+		want    string
+		wantErr string
+	}{
+		{
+			name:    "curseforge from config",
+			server:  curseForge,
+			url:     "https://www.curseforge.com/wow/addons/details",
+			apiKeys: map[string]string{"curseforge": "config-key"},
+			env:     map[string]string{"CURSEFORGE_API_KEY": "env-key"},
+			header:  "x-api-key",
+			want:    "config-key",
+		},
+		{
+			name:   "curseforge from environment",
+			server: curseForge,
+			url:    "https://www.curseforge.com/wow/addons/details",
+			env:    map[string]string{"CURSEFORGE_API_KEY": "env-key"},
+			header: "x-api-key",
+			want:   "env-key",
+		},
+		{
+			name:    "wago from config",
+			server:  wago,
+			url:     "https://addons.wago.io/addons/details",
+			apiKeys: map[string]string{"wago": "config-key"},
+			header:  "Authorization",
+			want:    "Bearer config-key",
+		},
+		{
+			name:   "wago from environment",
+			server: wago,
+			url:    "https://addons.wago.io/addons/details",
+			env:    map[string]string{"WAGO_API_KEY": "env-key"},
+			header: "Authorization",
+			want:   "Bearer env-key",
+		},
+		{
+			name:    "curseforge without a key",
+			server:  curseForge,
+			url:     "https://www.curseforge.com/wow/addons/details",
+			wantErr: "CurseForge needs an API key",
+		},
+		{
+			name:    "wago without a key",
+			server:  wago,
+			url:     "https://addons.wago.io/addons/details",
+			wantErr: "Wago needs an API key",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Setenv("CURSEFORGE_API_KEY", "")
+			t.Setenv("WAGO_API_KEY", "")
+			for key, value := range test.env {
+				t.Setenv(key, value)
+			}
+			test.server.last = nil
+
+			dir := DirectoryConfig{APIKeys: test.apiKeys}
+			addon := applyDirectoryDefaults(dir, []AddonConfig{{Name: "Details", URL: test.url, BaseURL: test.server.URL}})[0]
+			_, _, err := getDownloadURL(addon)
+			if test.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Fatalf("got error %v, want %q", err, test.wantErr)
+				}
+				if test.server.last != nil {
+					t.Errorf("API was called without a key")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := test.server.last.Header.Get(test.header); got != test.want {
+				t.Errorf("%s header is %q, want %q", test.header, got, test.want)
+			}
+		})
+	}
+}
+
+func TestFetchAddonArchiveFromSite(t *testing.T) {
+	var archive bytes.Buffer
+	writer := zip.NewWriter(&archive)
+	file, _ := writer.Create("Details/Details.toc")
+	file.Write([]byte("## Title: Details\n"))
+	writer.Close()
+
+	server := curseForgeServer(t)
+	server.files["/files/517/release.zip"] = archive.Bytes()
+
+	addon := AddonConfig{Name: "Details", URL: "https://www.curseforge.com/wow/addons/details", BaseURL: server.URL, APIKey: "key"}
+	cacheDir := t.TempDir()
+	cacheIndex := make(CacheIndex)
+
+	fetched, err := fetchAddonArchive(addon, cacheDir, cacheIndex, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fetched.FromCache || server.downloads != 1 {
+		t.Errorf("first fetch: from cache %v after %d downloads", fetched.FromCache, server.downloads)
+	}
+	if filepath.Dir(fetched.Path) != cacheDir {
+		t.Errorf("archive saved to %s, want it in %s", fetched.Path, cacheDir)
+	}
+	data, err := os.ReadFile(fetched.Path)
+	if err != nil || !bytes.Equal(data, archive.Bytes()) {
+		t.Errorf("cached archive doesn't match the download: %v", err)
+	}
+	if fetched.Entry.URL != server.URL+"/files/517/release.zip" || fetched.Entry.ETag == "" {
+		t.Errorf("cache entry %+v", fetched.Entry)
+	}
+
+	// An unchanged archive is revalidated rather than downloaded again
+	cacheIndex[getCacheKey(addon)] = fetched.Entry
+	fetched, err = fetchAddonArchive(addon, cacheDir, cacheIndex, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !fetched.FromCache || server.downloads != 1 {
+		t.Errorf("second fetch: from cache %v after %d downloads", fetched.FromCache, server.downloads)
+	}
+
+	// Refreshing downloads it again anyway
+	if _, err := fetchAddonArchive(addon, cacheDir, cacheIndex, true); err != nil {
+		t.Fatal(err)
+	}
+	if server.downloads != 2 {
+		t.Errorf("refreshed fetch: %d downloads, want 2", server.downloads)
+	}
+}
@@ -0,0 +1,519 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Source providers an addon URL can point at
+const (
+	providerGitHub = "github"
+	providerGitLab = "gitlab"
+	providerGitea  = "gitea" // Also Forgejo and Codeberg, which share Gitea's API
+
+	providerCurseForge   = "curseforge"
+	providerWago         = "wago"
+	providerWoWInterface = "wowinterface"
+)
+
+// SourceProvider resolves download URLs for a repository on one kind of forge
+type SourceProvider interface {
+	// URL of the zip archive of a branch or tag
+	archiveURL(ref string, isTag bool) string
+	// Newest published stable release and its assets
+	latestRelease() (SourceRelease, error)
+	// Branch the repository builds from when none is configured
+	defaultBranch() (string, error)
+	// Names of the repository's tags, newest first where the API orders them
+	listTags() ([]string, error)
+	// Published releases including prereleases, newest first
+	listReleases() ([]SourceRelease, error)
+}
+
+// SourceRelease is a published release of a repository
+type SourceRelease struct {
+	Tag        string
+	Prerelease bool // Flagged as a prerelease by its author
+	Assets     []ReleaseAsset
+}
+
+// ReleaseAsset is a file attached to a release
+type ReleaseAsset struct {
+	Name string
+	URL  string
+}
+
+// Work out which provider serves a repository URL from its host name.
+// Returns "" for hosts that need an explicit provider.
+func detectProvider(repoURL string) string {
+	parsed, err := url.Parse(repoURL)
+	if err != nil {
+		return ""
+	}
+	host := strings.ToLower(parsed.Hostname())
+
+	switch {
+	case host == "github.com":
+		return providerGitHub
+	case host == "gitlab.com", strings.Contains(host, "gitlab"):
+		return providerGitLab
+	case host == "codeberg.org", strings.Contains(host, "gitea"), strings.Contains(host, "forgejo"):
+		return providerGitea
+	case host == "curseforge.com", strings.HasSuffix(host, ".curseforge.com"):
+		return providerCurseForge
+	case host == "addons.wago.io":
+		return providerWago
+	case host == "wowinterface.com", strings.HasSuffix(host, ".wowinterface.com"):
+		return providerWoWInterface
+	}
+	return ""
+}
+
+// Provider an addon is fetched from, as configured or detected from its URL
+func addonProvider(addon AddonConfig) string {
+	if addon.Provider != "" {
+		return normalizeProvider(addon.Provider)
+	}
+	return detectProvider(addon.URL)
+}
+
+// Normalize provider names, accepting the forks of Gitea under their own names
+func normalizeProvider(provider string) string {
+	provider = strings.ToLower(strings.TrimSpace(provider))
+	switch provider {
+	case "forgejo", "codeberg":
+		return providerGitea
+	}
+	return provider
+}
+
+// Build the provider for an addon's repository. Self-hosted instances are
+// recognised by host name or set with "provider", and "base_url" covers
+// servers that live under a sub-path.
+func sourceProviderFor(addon AddonConfig) (SourceProvider, error) {
+	repoURL := strings.TrimSuffix(strings.TrimSuffix(addon.URL, "/"), ".git")
+	parsed, err := url.Parse(repoURL)
+	if err != nil || parsed.Host == "" {
+		return nil, fmt.Errorf("invalid repository URL '%s'", addon.URL)
+	}
+
+	baseURL := parsed.Scheme + "://" + parsed.Host
+	if addon.BaseURL != "" {
+		baseURL = strings.TrimSuffix(addon.BaseURL, "/")
+		if !strings.HasPrefix(repoURL, baseURL+"/") {
+			return nil, fmt.Errorf("url '%s' is not on base_url '%s'", addon.URL, addon.BaseURL)
+		}
+	}
+	repoPath := strings.Trim(strings.TrimPrefix(repoURL, baseURL), "/")
+
+	switch provider := addonProvider(addon); provider {
+	case providerGitHub:
+		owner, repo, err := ownerAndRepo(repoPath)
+		if err != nil {
+			return nil, err
+		}
+		apiURL := "https://api.github.com"
+		if parsed.Hostname() != "github.com" {
+			apiURL = baseURL + "/api/v3" // GitHub Enterprise
+		}
+		return githubSource{baseURL: baseURL, apiURL: apiURL, owner: owner, repo: repo, token: addon.APIKey}, nil
+	case providerGitLab:
+		// Drop page suffixes like /-/tree/main, GitLab projects may be nested in subgroups
+		if idx := strings.Index(repoPath, "/-/"); idx >= 0 {
+			repoPath = repoPath[:idx]
+		}
+		if !strings.Contains(repoPath, "/") {
+			return nil, fmt.Errorf("invalid GitLab URL format")
+		}
+		return gitlabSource{baseURL: baseURL, project: repoPath}, nil
+	case providerGitea:
+		owner, repo, err := ownerAndRepo(repoPath)
+		if err != nil {
+			return nil, err
+		}
+		return giteaSource{baseURL: baseURL, owner: owner, repo: repo}, nil
+	case providerCurseForge, providerWago, providerWoWInterface:
+		return nil, fmt.Errorf("%s is an addon site, not a repository", provider)
+	case "":
+		return nil, fmt.Errorf("unknown source host '%s', set \"provider\" to github, gitlab or gitea", parsed.Host)
+	default:
+		return nil, fmt.Errorf("unknown provider '%s'", addon.Provider)
+	}
+}
+
+// Headers for downloading an addon's archive. GitHub tokens are only sent to
+// the addon's own host and the API, never to wherever a download redirects.
+func downloadHeaders(addon AddonConfig, downloadURL string) map[string]string {
+	if addon.APIKey == "" || addonProvider(addon) != providerGitHub {
+		return nil
+	}
+
+	download, err := url.Parse(downloadURL)
+	if err != nil {
+		return nil
+	}
+	repo, err := url.Parse(addon.URL)
+	if err != nil {
+		return nil
+	}
+
+	host := strings.ToLower(download.Hostname())
+	if host != strings.ToLower(repo.Hostname()) && host != "api.github.com" {
+		return nil
+	}
+	return map[string]string{"Authorization": "Bearer " + addon.APIKey}
+}
+
+func ownerAndRepo(repoPath string) (string, string, error) {
+	parts := strings.Split(repoPath, "/")
+	if len(parts) < 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", fmt.Errorf("invalid repository URL format, expected <host>/<owner>/<repo>")
+	}
+	return parts[0], parts[1], nil
+}
+
+// Fetch a JSON document from a provider API, sending any extra headers.
+// Rate limits that pass within a minute are waited out once, longer ones
+// fail with a RateLimitError.
+func fetchJSON(apiURL, providerName string, headers map[string]string, target interface{}) error {
+	if limit := activeRateLimit(providerName); limit != nil {
+		return limit
+	}
+
+	var resp *http.Response
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequest(http.MethodGet, apiURL, nil)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Accept", "application/json")
+		for key, value := range headers {
+			req.Header.Set(key, value)
+		}
+
+		resp, err = http.DefaultClient.Do(req)
+		if err != nil {
+			return fmt.Errorf("failed to reach %s API: %v", providerName, err)
+		}
+
+		limit, wait := checkRateLimit(providerName, resp, len(headers) == 0)
+		if limit == nil {
+			break
+		}
+		resp.Body.Close()
+		if wait == 0 || attempt > 0 {
+			recordRateLimit(limit)
+			return limit
+		}
+		time.Sleep(wait)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s API returned status: %s", providerName, resp.Status)
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(target); err != nil {
+		return fmt.Errorf("failed to parse %s API response: %v", providerName, err)
+	}
+	return nil
+}
+
+// Default branches by repository, looked up at most once per run
+var defaultBranches = struct {
+	sync.Mutex
+	branches map[string]string
+}{branches: make(map[string]string)}
+
+// Resolve a repository's default branch through its provider's API
+func resolveDefaultBranch(addon AddonConfig, provider SourceProvider) (string, error) {
+	key := addonProvider(addon) + "|" + strings.ToLower(strings.TrimSuffix(strings.TrimSuffix(addon.URL, "/"), ".git"))
+
+	defaultBranches.Lock()
+	branch, exists := defaultBranches.branches[key]
+	defaultBranches.Unlock()
+	if exists {
+		return branch, nil
+	}
+
+	branch, err := provider.defaultBranch()
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve default branch: %w", err)
+	}
+	if branch == "" {
+		return "", fmt.Errorf("failed to resolve default branch: repository has no branches")
+	}
+
+	defaultBranches.Lock()
+	defaultBranches.branches[key] = branch
+	defaultBranches.Unlock()
+	return branch, nil
+}
+
+// Check if an addon downloads its repository's default branch
+func followsDefaultBranch(addon AddonConfig) bool {
+	if isLocalSource(addon.URL) || isGitSource(addon) || addon.LatestRelease ||
+		addon.Tag != "" || addon.Branch != "" || addon.Version != "" || addon.TagPattern != "" {
+		return false
+	}
+	_, isSite := addonSiteFor(addon)
+	return !isSite
+}
+
+// How long a remembered default branch is trusted before the API is asked
+// again, so a repository that switches to another branch is followed
+const defaultBranchTTL = 24 * time.Hour
+
+// Get the default branch to download and when it was looked up. The one
+// remembered in the cache entry is used while it's fresh, or while the API
+// can't tell, and a failing download looks it up again regardless.
+func knownDefaultBranch(addon AddonConfig, cached CacheEntry) (string, time.Time, error) {
+	if !followsDefaultBranch(addon) {
+		return "", time.Time{}, nil
+	}
+	if cached.DefaultBranch != "" && time.Since(cached.DefaultBranchChecked) < defaultBranchTTL {
+		return cached.DefaultBranch, cached.DefaultBranchChecked, nil
+	}
+
+	provider, err := sourceProviderFor(addon)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	branch, err := resolveDefaultBranch(addon, provider)
+	if err != nil {
+		if cached.DefaultBranch != "" {
+			return cached.DefaultBranch, cached.DefaultBranchChecked, nil
+		}
+		return "", time.Time{}, err
+	}
+	return branch, time.Now(), nil
+}
+
+// Tags and releases are listed from the first page of 100, which reaches
+// back far enough for any constraint worth pinning to
+const listPageSize = 100
+
+// RepositoryTag is a tag as the provider APIs list it
+type RepositoryTag struct {
+	Name string `json:"name"`
+}
+
+func tagNames(tags []RepositoryTag) []string {
+	names := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		names = append(names, tag.Name)
+	}
+	return names
+}
+
+// Convert GitHub-style releases, leaving out drafts
+func sourceReleases(releases []GitHubRelease) []SourceRelease {
+	var converted []SourceRelease
+	for _, release := range releases {
+		if !release.Draft {
+			converted = append(converted, release.sourceRelease())
+		}
+	}
+	return converted
+}
+
+// RepositoryInfo is the part of a repository the provider APIs describe alike
+type RepositoryInfo struct {
+	DefaultBranch string `json:"default_branch"`
+}
+
+// Convert a GitHub-style release, which Gitea and Forgejo also return
+func (r GitHubRelease) sourceRelease() SourceRelease {
+	release := SourceRelease{Tag: r.TagName, Prerelease: r.Prerelease}
+	for _, asset := range r.Assets {
+		release.Assets = append(release.Assets, ReleaseAsset{Name: asset.Name, URL: asset.BrowserDownloadURL})
+	}
+	return release
+}
+
+type githubSource struct {
+	baseURL, apiURL, owner, repo, token string
+}
+
+// Headers for GitHub API requests, with the token if there is one
+func (s githubSource) apiHeaders() map[string]string {
+	if s.token == "" {
+		return nil
+	}
+	return map[string]string{"Authorization": "Bearer " + s.token}
+}
+
+func (s githubSource) archiveURL(ref string, isTag bool) string {
+	kind := "heads"
+	if isTag {
+		kind = "tags"
+	}
+	return fmt.Sprintf("%s/%s/%s/archive/refs/%s/%s.zip", s.baseURL, s.owner, s.repo, kind, ref)
+}
+
+func (s githubSource) defaultBranch() (string, error) {
+	var repo RepositoryInfo
+	apiURL := fmt.Sprintf("%s/repos/%s/%s", s.apiURL, s.owner, s.repo)
+	if err := fetchJSON(apiURL, "GitHub", s.apiHeaders(), &repo); err != nil {
+		return "", err
+	}
+	return repo.DefaultBranch, nil
+}
+
+func (s githubSource) listTags() ([]string, error) {
+	var tags []RepositoryTag
+	apiURL := fmt.Sprintf("%s/repos/%s/%s/tags?per_page=%d", s.apiURL, s.owner, s.repo, listPageSize)
+	if err := fetchJSON(apiURL, "GitHub", s.apiHeaders(), &tags); err != nil {
+		return nil, err
+	}
+	return tagNames(tags), nil
+}
+
+func (s githubSource) listReleases() ([]SourceRelease, error) {
+	var releases []GitHubRelease
+	apiURL := fmt.Sprintf("%s/repos/%s/%s/releases?per_page=%d", s.apiURL, s.owner, s.repo, listPageSize)
+	if err := fetchJSON(apiURL, "GitHub", s.apiHeaders(), &releases); err != nil {
+		return nil, err
+	}
+	return sourceReleases(releases), nil
+}
+
+func (s githubSource) latestRelease() (SourceRelease, error) {
+	var release GitHubRelease
+	apiURL := fmt.Sprintf("%s/repos/%s/%s/releases/latest", s.apiURL, s.owner, s.repo)
+	if err := fetchJSON(apiURL, "GitHub", s.apiHeaders(), &release); err != nil {
+		return SourceRelease{}, err
+	}
+	return release.sourceRelease(), nil
+}
+
+type gitlabSource struct {
+	baseURL, project string
+}
+
+// GitLabRelease is a release as returned by the GitLab API
+type GitLabRelease struct {
+	TagName  string `json:"tag_name"`
+	Upcoming bool   `json:"upcoming_release"`
+	Assets   struct {
+		Links []struct {
+			Name           string `json:"name"`
+			URL            string `json:"url"`
+			DirectAssetURL string `json:"direct_asset_url"`
+		} `json:"links"`
+	} `json:"assets"`
+}
+
+func (s gitlabSource) archiveURL(ref string, isTag bool) string {
+	// Branches and tags share one archive endpoint
+	name := s.project[strings.LastIndex(s.project, "/")+1:]
+	return fmt.Sprintf("%s/%s/-/archive/%s/%s-%s.zip", s.baseURL, s.project, ref, name, strings.ReplaceAll(ref, "/", "-"))
+}
+
+func (s gitlabSource) defaultBranch() (string, error) {
+	var repo RepositoryInfo
+	apiURL := fmt.Sprintf("%s/api/v4/projects/%s", s.baseURL, url.PathEscape(s.project))
+	if err := fetchJSON(apiURL, "GitLab", nil, &repo); err != nil {
+		return "", err
+	}
+	return repo.DefaultBranch, nil
+}
+
+func (s gitlabSource) listTags() ([]string, error) {
+	var tags []RepositoryTag
+	apiURL := fmt.Sprintf("%s/api/v4/projects/%s/repository/tags?per_page=%d", s.baseURL, url.PathEscape(s.project), listPageSize)
+	if err := fetchJSON(apiURL, "GitLab", nil, &tags); err != nil {
+		return nil, err
+	}
+	return tagNames(tags), nil
+}
+
+func (s gitlabSource) listReleases() ([]SourceRelease, error) {
+	// Releases come newest first; upcoming releases aren't published yet
+	var releases []GitLabRelease
+	apiURL := fmt.Sprintf("%s/api/v4/projects/%s/releases?per_page=%d", s.baseURL, url.PathEscape(s.project), listPageSize)
+	if err := fetchJSON(apiURL, "GitLab", nil, &releases); err != nil {
+		return nil, err
+	}
+
+	var converted []SourceRelease
+	for _, r := range releases {
+		if r.Upcoming {
+			continue
+		}
+		release := SourceRelease{Tag: r.TagName}
+		for _, link := range r.Assets.Links {
+			assetURL := link.DirectAssetURL
+			if assetURL == "" {
+				assetURL = link.URL
+			}
+			release.Assets = append(release.Assets, ReleaseAsset{Name: link.Name, URL: assetURL})
+		}
+		converted = append(converted, release)
+	}
+	return converted, nil
+}
+
+func (s gitlabSource) latestRelease() (SourceRelease, error) {
+	releases, err := s.listReleases()
+	if err != nil {
+		return SourceRelease{}, err
+	}
+	// GitLab has no prerelease flag, only the tag name tells
+	for _, release := range releases {
+		if release.channel() == releaseTypeRelease {
+			return release, nil
+		}
+	}
+	return SourceRelease{}, fmt.Errorf("no stable releases found")
+}
+
+type giteaSource struct {
+	baseURL, owner, repo string
+}
+
+func (s giteaSource) archiveURL(ref string, isTag bool) string {
+	// Branches and tags share one archive endpoint
+	return fmt.Sprintf("%s/%s/%s/archive/%s.zip", s.baseURL, s.owner, s.repo, ref)
+}
+
+func (s giteaSource) defaultBranch() (string, error) {
+	var repo RepositoryInfo
+	apiURL := fmt.Sprintf("%s/api/v1/repos/%s/%s", s.baseURL, s.owner, s.repo)
+	if err := fetchJSON(apiURL, "Gitea", nil, &repo); err != nil {
+		return "", err
+	}
+	return repo.DefaultBranch, nil
+}
+
+func (s giteaSource) listTags() ([]string, error) {
+	var tags []RepositoryTag
+	apiURL := fmt.Sprintf("%s/api/v1/repos/%s/%s/tags?limit=%d", s.baseURL, s.owner, s.repo, listPageSize)
+	if err := fetchJSON(apiURL, "Gitea", nil, &tags); err != nil {
+		return nil, err
+	}
+	return tagNames(tags), nil
+}
+
+func (s giteaSource) listReleases() ([]SourceRelease, error) {
+	var releases []GitHubRelease
+	apiURL := fmt.Sprintf("%s/api/v1/repos/%s/%s/releases?limit=%d", s.baseURL, s.owner, s.repo, listPageSize)
+	if err := fetchJSON(apiURL, "Gitea", nil, &releases); err != nil {
+		return nil, err
+	}
+	return sourceReleases(releases), nil
+}
+
+func (s giteaSource) latestRelease() (SourceRelease, error) {
+	var release GitHubRelease
+	apiURL := fmt.Sprintf("%s/api/v1/repos/%s/%s/releases/latest", s.baseURL, s.owner, s.repo)
+	if err := fetchJSON(apiURL, "Gitea", nil, &release); err != nil {
+		return SourceRelease{}, err
+	}
+	return release.sourceRelease(), nil
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// Forget the default branches looked up so far, as a new run would
+func resetDefaultBranches() {
+	defaultBranches.Lock()
+	defaultBranches.branches = make(map[string]string)
+	defaultBranches.Unlock()
+}
+
+func TestDefaultBranchIsLookedUpAgainAfterTTL(t *testing.T) {
+	var archive bytes.Buffer
+	writer := zip.NewWriter(&archive)
+	file, _ := writer.Create("repo-main/MyAddon.toc")
+	file.Write([]byte("## Title: MyAddon\n"))
+	writer.Close()
+
+	server := newSiteServer(t)
+	defaultBranch, lookups := "main", 0
+	server.responses["/api/v3/repos/owner/repo"] = func(r *http.Request) interface{} {
+		lookups++
+		return map[string]string{"default_branch": defaultBranch}
+	}
+	server.files["/owner/repo/archive/refs/heads/main.zip"] = archive.Bytes()
+	server.files["/owner/repo/archive/refs/heads/dev.zip"] = archive.Bytes()
+
+	addon := AddonConfig{Name: "MyAddon", URL: server.URL + "/owner/repo", Provider: "github"}
+	cacheDir := t.TempDir()
+	cacheIndex := make(CacheIndex)
+	fetch := func() FetchedArchive {
+		t.Helper()
+		resetDefaultBranches()
+		fetched, err := fetchAddonArchive(addon, cacheDir, cacheIndex, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cacheIndex[getCacheKey(addon)] = fetched.Entry
+		return fetched
+	}
+	t.Cleanup(resetDefaultBranches)
+
+	if fetched := fetch(); fetched.Entry.DefaultBranch != "main" || lookups != 1 {
+		t.Fatalf("first run: branch %q after %d lookups", fetched.Entry.DefaultBranch, lookups)
+	}
+
+	// The repository switches branches but keeps the old one around
+	defaultBranch = "dev"
+	if fetched := fetch(); fetched.Entry.DefaultBranch != "main" || lookups != 1 {
+		t.Fatalf("second run: branch %q after %d lookups, want the remembered one", fetched.Entry.DefaultBranch, lookups)
+	}
+
+	// Once the remembered branch is old enough it is looked up again
+	entry := cacheIndex[getCacheKey(addon)]
+	entry.DefaultBranchChecked = time.Now().Add(-defaultBranchTTL - time.Minute)
+	cacheIndex[getCacheKey(addon)] = entry
+	fetched := fetch()
+	if fetched.Entry.DefaultBranch != "dev" || lookups != 2 {
+		t.Fatalf("after the TTL: branch %q after %d lookups", fetched.Entry.DefaultBranch, lookups)
+	}
+	if fetched.DownloadURL != server.URL+"/owner/repo/archive/refs/heads/dev.zip" {
+		t.Errorf("downloaded %s", fetched.DownloadURL)
+	}
+}
@@ -0,0 +1,286 @@
+package main
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Backup formats an installation can use
+const (
+	backupFormatZip   = "zip"   // One self-contained zip per backup (default)
+	backupFormatStore = "store" // Deduplicated store, file contents saved once by hash
+)
+
+// BackupSnapshot lists the files of one backup in the deduplicated store
+type BackupSnapshot struct {
+	Installation string         `json:"installation"`
+	Created      time.Time      `json:"created"`
+	AddedSize    int64          `json:"added_size"` // Bytes of new objects this snapshot stored
+	Files        []SnapshotFile `json:"files"`
+}
+
+// SnapshotFile is one file of a snapshot and the object holding its contents
+type SnapshotFile struct {
+	Path    string    `json:"path"`
+	Hash    string    `json:"hash"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+}
+
+func storeDirectory(backupDir string) string {
+	return filepath.Join(backupDir, "Store")
+}
+
+func snapshotDirectory(backupDir string) string {
+	return filepath.Join(storeDirectory(backupDir), "snapshots")
+}
+
+// Objects are named by the SHA-256 of their contents
+var objectHashPattern = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+func objectPath(backupDir, hash string) string {
+	return filepath.Join(storeDirectory(backupDir), "objects", hash[:2], hash)
+}
+
+func loadSnapshot(path string) (BackupSnapshot, error) {
+	var snapshot BackupSnapshot
+
+	file, err := os.Open(path)
+	if err != nil {
+		return snapshot, err
+	}
+	defer file.Close()
+
+	if err := json.NewDecoder(file).Decode(&snapshot); err != nil {
+		return snapshot, err
+	}
+
+	// Hashes name object files, a corrupted or edited one mustn't reach objectPath
+	for _, entry := range snapshot.Files {
+		if !objectHashPattern.MatchString(entry.Hash) {
+			return snapshot, fmt.Errorf("invalid object hash '%s' for %s", entry.Hash, entry.Path)
+		}
+	}
+	return snapshot, nil
+}
+
+// Snapshot the installation into the store, only storing contents not already
+// there. Returns the snapshot file path.
+func createStoreSnapshot(dirConfig DirectoryConfig, backupDir string) (string, error) {
+	snapshotDir := snapshotDirectory(backupDir)
+	if err := os.MkdirAll(snapshotDir, 0755); err != nil {
+		return "", err
+	}
+
+	// Reuse hashes of files unchanged since the latest snapshot
+	known := make(map[string]SnapshotFile)
+	for _, backup := range listFullBackups(backupDir, dirConfig.Name) {
+		if !backup.Snapshot {
+			continue
+		}
+		if previous, err := loadSnapshot(backup.Path); err == nil {
+			for _, file := range previous.Files {
+				known[file.Path] = file
+			}
+		}
+		break
+	}
+
+	snapshot := BackupSnapshot{
+		Installation: dirConfig.Name,
+		Created:      time.Now(),
+	}
+
+	err := walkFullBackupFiles(dirConfig, func(backupPath, path string, info os.FileInfo) error {
+		file := SnapshotFile{
+			Path:    backupPath,
+			Size:    info.Size(),
+			ModTime: info.ModTime(),
+		}
+
+		if previous, exists := known[backupPath]; exists && previous.Size == file.Size && previous.ModTime.Equal(file.ModTime) {
+			if _, err := os.Stat(objectPath(backupDir, previous.Hash)); err == nil {
+				file.Hash = previous.Hash
+			}
+		}
+
+		if file.Hash == "" {
+			hash, added, err := storeObject(backupDir, path)
+			if err != nil {
+				return err
+			}
+			file.Hash = hash
+			snapshot.AddedSize += added
+		}
+
+		snapshot.Files = append(snapshot.Files, file)
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	// Never overwrite an existing snapshot
+	out, err := createBackupFile(snapshotDir, dirConfig.Name, ".json", snapshot.Created)
+	if err != nil {
+		return "", err
+	}
+	snapshotPath := out.Name()
+
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "    ")
+	err = encoder.Encode(snapshot)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(snapshotPath)
+		return "", err
+	}
+
+	return snapshotPath, nil
+}
+
+// Store a file's contents by hash, returning the hash and the bytes added to the store
+func storeObject(backupDir, path string) (string, int64, error) {
+	hash, err := hashFile(path)
+	if err != nil {
+		return "", 0, err
+	}
+
+	target := objectPath(backupDir, hash)
+	if _, err := os.Stat(target); err == nil {
+		return hash, 0, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return "", 0, err
+	}
+
+	src, err := os.Open(path)
+	if err != nil {
+		return "", 0, err
+	}
+	defer src.Close()
+
+	// Write to a temporary file first so a crash never leaves a truncated object
+	tmp, err := os.CreateTemp(filepath.Dir(target), hash+".tmp-*")
+	if err != nil {
+		return "", 0, err
+	}
+
+	gz := gzip.NewWriter(tmp)
+	_, err = io.Copy(gz, src)
+	if closeErr := gz.Close(); err == nil {
+		err = closeErr
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), target)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return "", 0, err
+	}
+
+	info, err := os.Stat(target)
+	if err != nil {
+		return hash, 0, nil
+	}
+	return hash, info.Size(), nil
+}
+
+type gzipObjectReader struct {
+	*gzip.Reader
+	file *os.File
+}
+
+func (r gzipObjectReader) Close() error {
+	r.Reader.Close()
+	return r.file.Close()
+}
+
+func openObject(backupDir, hash string) (io.ReadCloser, error) {
+	file, err := os.Open(objectPath(backupDir, hash))
+	if err != nil {
+		return nil, err
+	}
+
+	reader, err := gzip.NewReader(file)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return gzipObjectReader{Reader: reader, file: file}, nil
+}
+
+// Delete objects no snapshot in the store references anymore
+func collectStoreGarbage(backupDir string) (int, int64, error) {
+	objectsDir := filepath.Join(storeDirectory(backupDir), "objects")
+	if _, err := os.Stat(objectsDir); err != nil {
+		return 0, 0, nil
+	}
+
+	// Snapshots of every installation sharing this backup directory count
+	referenced := make(map[string]bool)
+	entries, err := os.ReadDir(snapshotDirectory(backupDir))
+	if err != nil && !os.IsNotExist(err) {
+		return 0, 0, err
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+		snapshot, err := loadSnapshot(filepath.Join(snapshotDirectory(backupDir), entry.Name()))
+		if err != nil {
+			// Keep everything rather than risk deleting objects of an unreadable snapshot
+			return 0, 0, fmt.Errorf("failed to read snapshot %s: %v", entry.Name(), err)
+		}
+		for _, file := range snapshot.Files {
+			referenced[file.Hash] = true
+		}
+	}
+
+	var removed int
+	var freed int64
+	err = filepath.Walk(objectsDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() || referenced[info.Name()] {
+			return nil
+		}
+		if os.Remove(path) == nil {
+			removed++
+			freed += info.Size()
+		}
+		return nil
+	})
+	return removed, freed, err
+}
+
+func snapshotEntries(backup BackupInfo) ([]backupEntry, error) {
+	snapshot, err := loadSnapshot(backup.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	backupDir := filepath.Dir(filepath.Dir(filepath.Dir(backup.Path)))
+	entries := make([]backupEntry, 0, len(snapshot.Files))
+	for _, file := range snapshot.Files {
+		hash := file.Hash
+		entries = append(entries, backupEntry{
+			Name:     file.Path,
+			Modified: file.ModTime,
+			Open: func() (io.ReadCloser, error) {
+				return openObject(backupDir, hash)
+			},
+		})
+	}
+	return entries, nil
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSnapshotEntriesRejectsInvalidHashes(t *testing.T) {
+	validHash := strings.Repeat("ab", 32)
+	tests := []struct {
+		hash    string
+		wantErr bool
+	}{
+		{validHash, false},
+		{"", true},
+		{"a", true},
+		{strings.ToUpper(validHash), true},
+		{validHash[:63] + "g", true},
+		{"../" + validHash[3:], true},
+	}
+	for _, test := range tests {
+		snapshotDir := snapshotDirectory(t.TempDir())
+		if err := os.MkdirAll(snapshotDir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		data, _ := json.Marshal(BackupSnapshot{Files: []SnapshotFile{{Path: "Interface/AddOns/MyAddon/MyAddon.toc", Hash: test.hash}}})
+		path := filepath.Join(snapshotDir, "Test-full-20240101-120000.json")
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		_, err := snapshotEntries(BackupInfo{Path: path, Snapshot: true})
+		if (err != nil) != test.wantErr {
+			t.Errorf("hash %q: got error %v, want error %v", test.hash, err, test.wantErr)
+		}
+	}
+}
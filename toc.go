@@ -0,0 +1,358 @@
+package main
+
+import (
+	"archive/zip"
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// TocInfo holds the metadata from an addon folder's .toc file
+type TocInfo struct {
+	Folder                     string   `json:"folder"`
+	File                       string   `json:"file"`
+	Interface                  string   `json:"interface,omitempty"`
+	Title                      string   `json:"title,omitempty"`
+	Version                    string   `json:"version,omitempty"`
+	Author                     string   `json:"author,omitempty"`
+	RequiredDeps               []string `json:"required_deps,omitempty"`
+	OptionalDeps               []string `json:"optional_deps,omitempty"`
+	SavedVariables             []string `json:"saved_variables,omitempty"`
+	SavedVariablesPerCharacter []string `json:"saved_variables_per_character,omitempty"`
+}
+
+// WoW UI color escapes like |cffff0000Red|r
+var tocColorCode = regexp.MustCompile(`\|c[0-9a-fA-F]{8}|\|r`)
+
+func parseToc(r io.Reader) TocInfo {
+	var info TocInfo
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimPrefix(scanner.Text(), "\ufeff")
+		if !strings.HasPrefix(line, "##") {
+			continue
+		}
+
+		key, value, found := strings.Cut(strings.TrimPrefix(line, "##"), ":")
+		if !found {
+			continue
+		}
+		key = strings.TrimSpace(key)
+		value = strings.TrimSpace(value)
+
+		switch strings.ToLower(key) {
+		case "interface":
+			info.Interface = value
+		case "title":
+			info.Title = strings.TrimSpace(tocColorCode.ReplaceAllString(value, ""))
+		case "version":
+			// Packager tokens are left unsubstituted in plain repository archives
+			if !strings.HasPrefix(value, "@") {
+				info.Version = value
+			}
+		case "author":
+			info.Author = value
+		case "dependencies", "requireddeps", "dependancies":
+			info.RequiredDeps = appendTocList(info.RequiredDeps, value)
+		case "optionaldeps":
+			info.OptionalDeps = appendTocList(info.OptionalDeps, value)
+		case "savedvariables":
+			info.SavedVariables = appendTocList(info.SavedVariables, value)
+		case "savedvariablespercharacter":
+			info.SavedVariablesPerCharacter = appendTocList(info.SavedVariablesPerCharacter, value)
+		}
+	}
+
+	return info
+}
+
+func appendTocList(list []string, value string) []string {
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+func parseTocFile(path string) (TocInfo, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return TocInfo{}, err
+	}
+	defer file.Close()
+
+	info := parseToc(file)
+	info.File = filepath.Base(path)
+	return info, nil
+}
+
+// Find the .toc file WoW would load for an addon folder
+func findTocFile(folderPath string) string {
+	entries, err := os.ReadDir(folderPath)
+	if err != nil {
+		return ""
+	}
+
+	var names []string
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			names = append(names, entry.Name())
+		}
+	}
+	if name := pickTocFile(filepath.Base(folderPath), names); name != "" {
+		return filepath.Join(folderPath, name)
+	}
+	return ""
+}
+
+// Pick the .toc file WoW would load among the files of an addon folder
+func pickTocFile(folder string, names []string) string {
+	folder = strings.ToLower(folder)
+	var flavored, other []string
+	for _, name := range names {
+		lower := strings.ToLower(name)
+		if !strings.HasSuffix(lower, ".toc") {
+			continue
+		}
+
+		base := strings.TrimSuffix(lower, ".toc")
+		switch {
+		case base == folder:
+			return name
+		case strings.HasPrefix(base, folder+"-") || strings.HasPrefix(base, folder+"_"):
+			// Flavor-specific files like MyAddon_Wrath.toc or MyAddon-Classic.toc
+			flavored = append(flavored, name)
+		default:
+			other = append(other, name)
+		}
+	}
+
+	if len(flavored) > 0 {
+		sort.Strings(flavored)
+		return flavored[0]
+	}
+	if len(other) > 0 {
+		sort.Strings(other)
+		return other[0]
+	}
+	return ""
+}
+
+func readFolderToc(targetDir, folder string) (TocInfo, error) {
+	folderPath := filepath.Join(targetDir, folder)
+	tocPath := findTocFile(folderPath)
+	if tocPath == "" {
+		return TocInfo{Folder: folder}, fmt.Errorf("no .toc file found in %s", folder)
+	}
+
+	info, err := parseTocFile(tocPath)
+	info.Folder = folder
+	return info, err
+}
+
+// Get the folders an addon has installed
+func installedFolders(addon AddonConfig, targetDir string, manifest Manifest) []string {
+	if entry, exists := manifest[addon.Name]; exists {
+		return entry.Folders
+	}
+	if addon.Folder != "" {
+		if _, err := os.Stat(filepath.Join(targetDir, addon.Folder)); err == nil {
+			return []string{addon.Folder}
+		}
+	}
+	return nil
+}
+
+// Read the TOC metadata of every folder an addon has installed
+func readAddonTocs(addon AddonConfig, targetDir string, manifest Manifest) []TocInfo {
+	var tocs []TocInfo
+	for _, folder := range installedFolders(addon, targetDir, manifest) {
+		if info, err := readFolderToc(targetDir, folder); err == nil {
+			tocs = append(tocs, info)
+		}
+	}
+	return tocs
+}
+
+// ArchiveContents is what a fetched archive would install
+type ArchiveContents struct {
+	Folders []string
+	Tocs    []TocInfo
+}
+
+// Read the folders an addon's archive would install and the TOC metadata
+// of each, before anything is extracted
+func readArchiveContents(archivePath string, addon AddonConfig) (ArchiveContents, error) {
+	var contents ArchiveContents
+	reader, err := zip.OpenReader(archivePath)
+	if err != nil {
+		return contents, err
+	}
+	defer reader.Close()
+
+	if err := checkArchiveEntries(reader.File, addon.Limits.withDefaults()); err != nil {
+		return contents, err
+	}
+	planned, err := planArchiveFiles(reader.File, addon)
+	if err != nil {
+		return contents, err
+	}
+
+	// Files directly inside each top-level folder
+	folderFiles := make(map[string]map[string]*zip.File)
+	for _, plan := range planned {
+		parts := strings.Split(plan.Path, "/")
+		if len(parts) < 2 {
+			continue
+		}
+		if folderFiles[parts[0]] == nil {
+			folderFiles[parts[0]] = make(map[string]*zip.File)
+			contents.Folders = append(contents.Folders, parts[0])
+		}
+		if len(parts) == 2 {
+			folderFiles[parts[0]][parts[1]] = plan.File
+		}
+	}
+	sort.Strings(contents.Folders)
+
+	for _, folder := range contents.Folders {
+		var names []string
+		for name := range folderFiles[folder] {
+			names = append(names, name)
+		}
+		tocName := pickTocFile(folder, names)
+		if tocName == "" {
+			continue
+		}
+
+		file, err := folderFiles[folder][tocName].Open()
+		if err != nil {
+			return contents, err
+		}
+		info := parseToc(io.LimitReader(file, maxVerificationFileSize))
+		file.Close()
+		info.Folder = folder
+		info.File = tocName
+		contents.Tocs = append(contents.Tocs, info)
+	}
+	return contents, nil
+}
+
+// Best description of the installed version for status lines
+func installedVersion(addon AddonConfig, targetDir string, manifest Manifest) string {
+	tocs := readAddonTocs(addon, targetDir, manifest)
+
+	// Prefer the folder named after the addon, then any folder with a version
+	for _, toc := range tocs {
+		if strings.EqualFold(toc.Folder, addon.Folder) || strings.EqualFold(toc.Folder, addon.Name) {
+			if toc.Version != "" {
+				return toc.Version
+			}
+		}
+	}
+	for _, toc := range tocs {
+		if toc.Version != "" {
+			return toc.Version
+		}
+	}
+
+	if entry, exists := manifest[addon.Name]; exists {
+		return entry.Version
+	}
+	return ""
+}
+
+func formatVersionSuffix(version string) string {
+	if version == "" {
+		return ""
+	}
+	return fmt.Sprintf(" (%s)", version)
+}
+
+func runInfo(name string) error {
+	config, err := loadConfig("config.json")
+	if err != nil {
+		return fmt.Errorf("error loading config: %v", err)
+	}
+
+	found := false
+	for _, dir := range config {
+		for _, addon := range dir.Addons {
+			if !strings.EqualFold(addon.Name, name) {
+				continue
+			}
+			found = true
+
+			aggonDir := filepath.Join(filepath.Dir(dir.Path), "Aggon")
+			manifest := loadManifest(aggonDir)
+			printAddonInfo(dir, addon, manifest)
+		}
+	}
+
+	if !found {
+		return fmt.Errorf("addon '%s' not found in config", name)
+	}
+	return nil
+}
+
+func printAddonInfo(dir DirectoryConfig, addon AddonConfig, manifest Manifest) {
+	fmt.Printf("📦 %s\n", addon.Name)
+	fmt.Printf("   Installation: %s (%s)\n", dir.Name, dir.Path)
+	fmt.Printf("   URL: %s\n", addon.URL)
+	if addon.Disabled {
+		fmt.Println("   Status: disabled")
+	}
+
+	entry, exists := manifest[addon.Name]
+	if exists {
+		if entry.Version != "" {
+			fmt.Printf("   Source Version: %s\n", entry.Version)
+		}
+		if entry.ArchiveHash != "" {
+			fmt.Printf("   Archive Hash: %s\n", shortHash(entry.ArchiveHash, 16))
+		}
+		fmt.Printf("   Installed: %s\n", entry.InstalledAt.Format("2006-01-02 15:04:05"))
+		fmt.Printf("   Files: %d\n", len(entry.Files))
+	}
+
+	folders := installedFolders(addon, dir.Path, manifest)
+	if len(folders) == 0 {
+		fmt.Println("   ⚠ Not installed")
+		fmt.Println()
+		return
+	}
+
+	for _, folder := range folders {
+		fmt.Println()
+		info, err := readFolderToc(dir.Path, folder)
+		if err != nil {
+			fmt.Printf("   📁 %s - %v\n", folder, err)
+			continue
+		}
+
+		fmt.Printf("   📁 %s (%s)\n", folder, info.File)
+		printTocField("Title", info.Title)
+		printTocField("Version", info.Version)
+		printTocField("Author", info.Author)
+		printTocField("Interface", info.Interface)
+		printTocField("Required Deps", strings.Join(info.RequiredDeps, ", "))
+		printTocField("Optional Deps", strings.Join(info.OptionalDeps, ", "))
+		printTocField("SavedVariables", strings.Join(info.SavedVariables, ", "))
+		printTocField("SavedVariablesPerCharacter", strings.Join(info.SavedVariablesPerCharacter, ", "))
+	}
+	fmt.Println()
+}
+
+func printTocField(label, value string) {
+	if value != "" {
+		fmt.Printf("      %s: %s\n", label, value)
+	}
+}
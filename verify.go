@@ -0,0 +1,316 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"golang.org/x/crypto/blake2b"
+)
+
+// Checksum and signature files are small, anything bigger isn't one
+const maxVerificationFileSize = 1 << 20
+
+// Release assets listing checksums for every other asset
+var checksumListNames = []string{"checksums.txt", "sha256sums", "sha256sums.txt", "checksums.sha256"}
+
+// Check if a release asset is a checksum or signature file rather than an archive
+func isVerificationAsset(name string) bool {
+	name = strings.ToLower(name)
+	for _, listName := range checksumListNames {
+		if name == listName {
+			return true
+		}
+	}
+	for _, extension := range []string{".sha256", ".sha256sum", ".minisig", ".asc", ".sig", ".gpg"} {
+		if strings.HasSuffix(name, extension) {
+			return true
+		}
+	}
+	return false
+}
+
+// Check a fetched archive before it is extracted: against the addon's sha256
+// pin, the checksum files published next to it in its release and, with a
+// signing key configured, the signature over the archive or its checksums.
+// Assets are those of the release the archive came from, nil for other downloads.
+func verifyArchive(addon AddonConfig, archive FetchedArchive, assets []ReleaseAsset) error {
+	if addon.SHA256 != "" && !strings.EqualFold(addon.SHA256, archive.Entry.Hash) {
+		return fmt.Errorf("archive checksum %s does not match the sha256 pin %s", archive.Entry.Hash, addon.SHA256)
+	}
+
+	// Without a release there is nothing published to check against. Stale
+	// archives were checked when they were downloaded.
+	if archive.Stale != "" {
+		return nil
+	}
+
+	var archiveAsset *ReleaseAsset
+	for i := range assets {
+		if assets[i].URL == archive.DownloadURL {
+			archiveAsset = &assets[i]
+			break
+		}
+	}
+	if archiveAsset == nil {
+		if addon.SigningKey != "" {
+			return fmt.Errorf("signing_key needs a release asset to verify, use latest_release")
+		}
+		return nil
+	}
+
+	checksumAsset, checksums, err := verifyReleaseChecksum(addon, *archiveAsset, archive.Entry.Hash, assets)
+	if err != nil {
+		return err
+	}
+
+	if addon.SigningKey == "" {
+		return nil
+	}
+	key, err := loadSigningKey(addon.SigningKey)
+	if err != nil {
+		return err
+	}
+
+	// A signature over the archive itself, or over the checksums that vouch for it
+	if signature := findSignature(assets, archiveAsset.Name, key); signature != nil {
+		file, err := os.Open(archive.Path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		return checkSignature(addon, key, *signature, file)
+	}
+	if checksumAsset != nil {
+		if signature := findSignature(assets, checksumAsset.Name, key); signature != nil {
+			return checkSignature(addon, key, *signature, bytes.NewReader(checksums))
+		}
+	}
+	return fmt.Errorf("no %s signature found for %s", key.kind(), archiveAsset.Name)
+}
+
+// Check the archive against the release's checksum files. Returns the
+// checksum file that listed the archive and its contents, or nil if none did.
+func verifyReleaseChecksum(addon AddonConfig, archiveAsset ReleaseAsset, hash string, assets []ReleaseAsset) (*ReleaseAsset, []byte, error) {
+	for i, asset := range assets {
+		name := strings.ToLower(asset.Name)
+		isOwnChecksum := name == strings.ToLower(archiveAsset.Name)+".sha256" || name == strings.ToLower(archiveAsset.Name)+".sha256sum"
+		isChecksumList := false
+		for _, listName := range checksumListNames {
+			if name == listName {
+				isChecksumList = true
+			}
+		}
+		if !isOwnChecksum && !isChecksumList {
+			continue
+		}
+
+		contents, err := fetchReleaseFile(addon, asset)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to download %s: %v", asset.Name, err)
+		}
+
+		expected, listed := findChecksum(contents, archiveAsset.Name, isOwnChecksum)
+		if !listed {
+			continue
+		}
+		if !strings.EqualFold(expected, hash) {
+			return nil, nil, fmt.Errorf("archive checksum %s does not match %s from %s", hash, expected, asset.Name)
+		}
+		return &assets[i], contents, nil
+	}
+	return nil, nil, nil
+}
+
+// Find the SHA-256 of a file in sha256sum output ("<hash>  <name>" or
+// "<hash> *<name>"). A file's own .sha256 may hold just the hash.
+func findChecksum(contents []byte, name string, ownFile bool) (string, bool) {
+	scanner := bufio.NewScanner(bytes.NewReader(contents))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || len(fields[0]) != 64 {
+			continue
+		}
+		if len(fields) == 1 && ownFile {
+			return fields[0], true
+		}
+		if len(fields) >= 2 && path.Base(strings.TrimPrefix(fields[len(fields)-1], "*")) == name {
+			return fields[0], true
+		}
+	}
+	return "", false
+}
+
+// Download a small file attached to a release
+func fetchReleaseFile(addon AddonConfig, asset ReleaseAsset) ([]byte, error) {
+	source, _, err := openArchiveSource(asset.URL, downloadHeaders(addon, asset.URL))
+	if err != nil {
+		return nil, err
+	}
+	defer source.Close()
+
+	contents, err := io.ReadAll(io.LimitReader(source, maxVerificationFileSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(contents) > maxVerificationFileSize {
+		return nil, fmt.Errorf("file is too large")
+	}
+	return contents, nil
+}
+
+// SigningKey is a public key archives can be verified against, either
+// minisign or OpenPGP
+type SigningKey struct {
+	minisign *minisignKey
+	openpgp  openpgp.EntityList
+}
+
+func (k SigningKey) kind() string {
+	if k.minisign != nil {
+		return "minisign"
+	}
+	return "OpenPGP"
+}
+
+// Signature file extensions for the key's kind
+func (k SigningKey) extensions() []string {
+	if k.minisign != nil {
+		return []string{".minisig"}
+	}
+	return []string{".asc", ".sig", ".gpg"}
+}
+
+// Load a signing key: a minisign public key or armored OpenPGP key given
+// inline, or the path of a minisign .pub file or an OpenPGP key file
+func loadSigningKey(value string) (SigningKey, error) {
+	value = strings.TrimSpace(value)
+	contents := []byte(value)
+	if !strings.Contains(value, "\n") && !strings.HasPrefix(value, "RW") {
+		var err error
+		contents, err = os.ReadFile(value)
+		if err != nil {
+			return SigningKey{}, fmt.Errorf("failed to read signing_key: %v", err)
+		}
+	}
+
+	if bytes.Contains(contents, []byte("-----BEGIN PGP")) {
+		keyring, err := openpgp.ReadArmoredKeyRing(bytes.NewReader(contents))
+		if err != nil {
+			return SigningKey{}, fmt.Errorf("invalid OpenPGP signing_key: %v", err)
+		}
+		return SigningKey{openpgp: keyring}, nil
+	}
+
+	if key, err := parseMinisignKey(contents); err == nil {
+		return SigningKey{minisign: key}, nil
+	}
+
+	keyring, err := openpgp.ReadKeyRing(bytes.NewReader(contents))
+	if err != nil {
+		return SigningKey{}, fmt.Errorf("signing_key is neither a minisign nor an OpenPGP public key")
+	}
+	return SigningKey{openpgp: keyring}, nil
+}
+
+// Find the signature asset of a file for the key's kind
+func findSignature(assets []ReleaseAsset, name string, key SigningKey) *ReleaseAsset {
+	for _, extension := range key.extensions() {
+		for i, asset := range assets {
+			if strings.EqualFold(asset.Name, name+extension) {
+				return &assets[i]
+			}
+		}
+	}
+	return nil
+}
+
+// Download a signature and verify the signed contents against the key
+func checkSignature(addon AddonConfig, key SigningKey, signature ReleaseAsset, signed io.Reader) error {
+	contents, err := fetchReleaseFile(addon, signature)
+	if err != nil {
+		return fmt.Errorf("failed to download %s: %v", signature.Name, err)
+	}
+
+	if key.minisign != nil {
+		data, err := io.ReadAll(signed)
+		if err != nil {
+			return err
+		}
+		err = key.minisign.verify(data, contents)
+		if err != nil {
+			return fmt.Errorf("signature %s is invalid: %v", signature.Name, err)
+		}
+		return nil
+	}
+
+	if bytes.HasPrefix(bytes.TrimSpace(contents), []byte("-----BEGIN PGP SIGNATURE")) {
+		_, err = openpgp.CheckArmoredDetachedSignature(key.openpgp, signed, bytes.NewReader(contents), nil)
+	} else {
+		_, err = openpgp.CheckDetachedSignature(key.openpgp, signed, bytes.NewReader(contents), nil)
+	}
+	if err != nil {
+		return fmt.Errorf("signature %s is invalid: %v", signature.Name, err)
+	}
+	return nil
+}
+
+type minisignKey struct {
+	id  []byte
+	key ed25519.PublicKey
+}
+
+// Parse a minisign public key, on its own or as the .pub file with its comment line
+func parseMinisignKey(contents []byte) (*minisignKey, error) {
+	lines := strings.Split(strings.TrimSpace(string(contents)), "\n")
+	decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(lines[len(lines)-1]))
+	if err != nil || len(decoded) != 2+8+ed25519.PublicKeySize || string(decoded[:2]) != "Ed" {
+		return nil, fmt.Errorf("invalid minisign public key")
+	}
+	return &minisignKey{id: decoded[2:10], key: decoded[10:]}, nil
+}
+
+// Verify a minisign signature file: the signature over the data, prehashed
+// with BLAKE2b for "ED" signatures, and the global signature binding the
+// trusted comment to it
+func (k *minisignKey) verify(data, signatureFile []byte) error {
+	lines := strings.Split(strings.ReplaceAll(string(signatureFile), "\r\n", "\n"), "\n")
+	if len(lines) < 4 || !strings.HasPrefix(lines[2], "trusted comment: ") {
+		return fmt.Errorf("malformed signature file")
+	}
+
+	signature, err := base64.StdEncoding.DecodeString(strings.TrimSpace(lines[1]))
+	if err != nil || len(signature) != 2+8+ed25519.SignatureSize {
+		return fmt.Errorf("malformed signature")
+	}
+	if !bytes.Equal(signature[2:10], k.id) {
+		return fmt.Errorf("signed with a different key")
+	}
+
+	switch string(signature[:2]) {
+	case "Ed":
+	case "ED":
+		hash := blake2b.Sum512(data)
+		data = hash[:]
+	default:
+		return fmt.Errorf("unsupported signature algorithm")
+	}
+	if !ed25519.Verify(k.key, data, signature[10:]) {
+		return fmt.Errorf("signature does not match")
+	}
+
+	trustedComment := strings.TrimPrefix(lines[2], "trusted comment: ")
+	globalSignature, err := base64.StdEncoding.DecodeString(strings.TrimSpace(lines[3]))
+	signedComment := append(append([]byte{}, signature[10:]...), trustedComment...)
+	if err != nil || !ed25519.Verify(k.key, signedComment, globalSignature) {
+		return fmt.Errorf("trusted comment signature does not match")
+	}
+	return nil
+}
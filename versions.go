@@ -0,0 +1,386 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Version is a dotted version number parsed from a tag, like 1.15.3 or
+// 3.3.5.12, with an optional prerelease suffix
+type Version struct {
+	Parts      []int
+	Prerelease string
+}
+
+// First dotted number in a tag, so "v1.15.3", "release-2.0" and "1.15-beta2"
+// all parse. A numbered revision like the 1 of "3.3.5-1" counts as one more
+// part; only alpha, beta, rc and pre mark prereleases, other suffixes like
+// "-classic" or "+build7" metadata don't change the version.
+var versionPattern = regexp.MustCompile(`(\d+(?:\.\d+)*)(?:-(\d+)\b)?(?:[-.]?((?:alpha|beta|rc|pre)[0-9.]*))?`)
+
+func parseVersion(value string) (Version, bool) {
+	match := versionPattern.FindStringSubmatch(strings.ToLower(value))
+	if match == nil {
+		return Version{}, false
+	}
+
+	numbers := strings.Split(match[1], ".")
+	if match[2] != "" {
+		numbers = append(numbers, match[2])
+	}
+
+	var version Version
+	for _, part := range numbers {
+		number, err := strconv.Atoi(part)
+		if err != nil {
+			return Version{}, false
+		}
+		version.Parts = append(version.Parts, number)
+	}
+	version.Prerelease = strings.TrimLeft(match[3], "-.")
+	return version, true
+}
+
+// Tag naming conventions of prereleases, like v2.0-alpha3, 1.5.0-beta or 3.1-rc1
+var (
+	alphaTagPattern = regexp.MustCompile(`(?i)alpha`)
+	betaTagPattern  = regexp.MustCompile(`(?i)beta|(^|[^a-z])(rc|pre|preview)([^a-z]|$)`)
+)
+
+// Get the least stable channel a tag belongs to by its name
+func tagChannel(tag string) int {
+	switch {
+	case alphaTagPattern.MatchString(tag):
+		return releaseTypeAlpha
+	case betaTagPattern.MatchString(tag):
+		return releaseTypeBeta
+	}
+	return releaseTypeRelease
+}
+
+// Get the channel of a release from its tag name and prerelease flag
+func (r SourceRelease) channel() int {
+	channel := tagChannel(r.Tag)
+	if r.Prerelease && channel == releaseTypeRelease {
+		channel = releaseTypeBeta
+	}
+	return channel
+}
+
+// Compare two versions, missing parts count as zero and prereleases sort
+// before the release they lead up to
+func compareVersions(a, b Version) int {
+	for i := 0; i < len(a.Parts) || i < len(b.Parts); i++ {
+		var x, y int
+		if i < len(a.Parts) {
+			x = a.Parts[i]
+		}
+		if i < len(b.Parts) {
+			y = b.Parts[i]
+		}
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+
+	switch {
+	case a.Prerelease == b.Prerelease:
+		return 0
+	case a.Prerelease == "":
+		return 1
+	case b.Prerelease == "":
+		return -1
+	}
+	return comparePrereleases(a.Prerelease, b.Prerelease)
+}
+
+// Splits prereleases into words and numbers, "beta10" or "rc.1" into beta, 10
+var prereleaseSegment = regexp.MustCompile(`[a-z]+|\d+`)
+
+// Compare prereleases segment by segment like semver: numbers numerically,
+// words alphabetically, numbers before words and fewer segments first
+func comparePrereleases(a, b string) int {
+	x, y := prereleaseSegment.FindAllString(a, -1), prereleaseSegment.FindAllString(b, -1)
+	for i := 0; i < len(x) && i < len(y); i++ {
+		xNumber, xErr := strconv.Atoi(x[i])
+		yNumber, yErr := strconv.Atoi(y[i])
+		switch {
+		case xErr == nil && yErr == nil:
+			if xNumber != yNumber {
+				if xNumber < yNumber {
+					return -1
+				}
+				return 1
+			}
+		case xErr == nil:
+			return -1
+		case yErr == nil:
+			return 1
+		case x[i] != y[i]:
+			if x[i] < y[i] {
+				return -1
+			}
+			return 1
+		}
+	}
+	switch {
+	case len(x) < len(y):
+		return -1
+	case len(x) > len(y):
+		return 1
+	}
+	return strings.Compare(a, b)
+}
+
+type comparator struct {
+	op      string
+	version Version
+}
+
+// VersionConstraint is a set of alternatives separated by "||", each a list
+// of comparators that must all hold, e.g. "^1.15", "~2.3" or ">=1.0 <2.0"
+type VersionConstraint [][]comparator
+
+func parseConstraint(value string) (VersionConstraint, error) {
+	var constraint VersionConstraint
+	for _, alternative := range strings.Split(value, "||") {
+		var comparators []comparator
+		fields := strings.Fields(alternative)
+		for i := 0; i < len(fields); i++ {
+			// An operator written apart from its version, like ">= 1.0"
+			field := fields[i]
+			if strings.Trim(field, "<>=^~") == "" && i+1 < len(fields) {
+				i++
+				field += fields[i]
+			}
+			parsed, err := parseComparator(field)
+			if err != nil {
+				return nil, err
+			}
+			comparators = append(comparators, parsed...)
+		}
+		if len(comparators) == 0 {
+			return nil, fmt.Errorf("invalid version constraint '%s'", value)
+		}
+		constraint = append(constraint, comparators)
+	}
+	return constraint, nil
+}
+
+// Expand one constraint term into plain comparisons
+func parseComparator(term string) ([]comparator, error) {
+	op := ""
+	for _, prefix := range []string{">=", "<=", ">", "<", "=", "^", "~"} {
+		if strings.HasPrefix(term, prefix) {
+			op = prefix
+			term = strings.TrimSpace(term[len(prefix):])
+			break
+		}
+	}
+
+	// Partial versions and wildcards like 1.15, 1.x or 1.* cover a whole range
+	parts := strings.Split(strings.TrimPrefix(strings.ToLower(term), "v"), ".")
+	for i, part := range parts {
+		if part == "x" || part == "*" {
+			parts = parts[:i]
+			break
+		}
+	}
+	version, ok := parseVersion(strings.Join(parts, "."))
+	if len(parts) == 0 {
+		version, ok = Version{}, op == "" || op == "="
+	}
+	if !ok {
+		return nil, fmt.Errorf("invalid version '%s' in constraint", term)
+	}
+	specified := len(version.Parts)
+
+	// Upper bound that increments the part at the given index
+	bump := func(index int) Version {
+		upper := Version{Parts: make([]int, index+1), Prerelease: "0"}
+		copy(upper.Parts, version.Parts)
+		upper.Parts[index]++
+		return upper
+	}
+
+	switch op {
+	case "^":
+		// Changes that don't touch the first non-zero part
+		index := 0
+		for index < specified-1 && version.Parts[index] == 0 {
+			index++
+		}
+		return []comparator{{">=", version}, {"<", bump(index)}}, nil
+	case "~":
+		// Patch changes, or minor ones if only the major version is given
+		index := 1
+		if specified < 2 {
+			index = 0
+		}
+		return []comparator{{">=", version}, {"<", bump(index)}}, nil
+	case "", "=":
+		if specified == 0 {
+			return []comparator{{">=", Version{}}}, nil
+		}
+		if specified < 3 && version.Prerelease == "" {
+			return []comparator{{">=", version}, {"<", bump(specified - 1)}}, nil
+		}
+		return []comparator{{"=", version}}, nil
+	}
+	return []comparator{{op, version}}, nil
+}
+
+func (c comparator) matches(version Version) bool {
+	result := compareVersions(version, c.version)
+	switch c.op {
+	case ">=":
+		return result >= 0
+	case "<=":
+		return result <= 0
+	case ">":
+		return result > 0
+	case "<":
+		return result < 0
+	}
+	return result == 0
+}
+
+// Check if the constraint names a prerelease, like >=2.0-beta1
+func (c VersionConstraint) mentionsPrerelease() bool {
+	for _, comparators := range c {
+		for _, comp := range comparators {
+			if comp.version.Prerelease != "" && comp.version.Prerelease != "0" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Check a version against the constraint, prereleases only match if allowed
+func (c VersionConstraint) matches(version Version, allowPrerelease bool) bool {
+	if version.Prerelease != "" && !allowPrerelease {
+		return false
+	}
+
+	for _, comparators := range c {
+		matched := true
+		for _, comp := range comparators {
+			if !comp.matches(version) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return true
+		}
+	}
+	return false
+}
+
+// TagSelector picks the highest tag matching an addon's version constraint and tag pattern
+type TagSelector struct {
+	pattern    *regexp.Regexp
+	constraint VersionConstraint
+	version    string // The constraint as configured, for messages
+}
+
+// Build the selector for an addon, or nil if it doesn't use version or tag_pattern
+func newTagSelector(addon AddonConfig) (*TagSelector, error) {
+	if addon.Version == "" && addon.TagPattern == "" {
+		return nil, nil
+	}
+	if addon.Tag != "" {
+		return nil, fmt.Errorf("set either tag or version/tag_pattern, not both")
+	}
+
+	selector := &TagSelector{version: addon.Version}
+	if addon.TagPattern != "" {
+		pattern, err := regexp.Compile(addon.TagPattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid tag_pattern: %v", err)
+		}
+		selector.pattern = pattern
+	}
+	if addon.Version != "" {
+		constraint, err := parseConstraint(addon.Version)
+		if err != nil {
+			return nil, err
+		}
+		selector.constraint = constraint
+	}
+	return selector, nil
+}
+
+// Widen the channel when the version constraint asks for a prerelease
+func (s *TagSelector) allowedChannel(channel int) int {
+	if s.constraint != nil && s.constraint.mentionsPrerelease() {
+		return releaseTypeAlpha
+	}
+	return channel
+}
+
+// Get the version a tag stands for. With a capture group in tag_pattern the
+// version is read from the first group, otherwise from the tag itself.
+func (s *TagSelector) tagVersion(tag string) (Version, bool) {
+	if s.pattern != nil {
+		if match := s.pattern.FindStringSubmatch(tag); len(match) > 1 && match[1] != "" {
+			return parseVersion(match[1])
+		}
+	}
+	return parseVersion(tag)
+}
+
+// Pick the highest matching tag allowed on the channel. Tags without a
+// version, only possible without a version constraint, rank below versioned
+// ones in the given order.
+func (s *TagSelector) pick(tags []string, channel int) (string, error) {
+	channel = s.allowedChannel(channel)
+
+	type candidate struct {
+		tag       string
+		version   Version
+		versioned bool
+	}
+
+	var candidates []candidate
+	for _, tag := range tags {
+		if (s.pattern != nil && !s.pattern.MatchString(tag)) || tagChannel(tag) > channel {
+			continue
+		}
+		version, versioned := s.tagVersion(tag)
+		if s.constraint != nil && (!versioned || !s.constraint.matches(version, channel > releaseTypeRelease)) {
+			continue
+		}
+		candidates = append(candidates, candidate{tag, version, versioned})
+	}
+
+	if len(candidates) == 0 {
+		return "", fmt.Errorf("no tag matches %s", s.describe())
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if candidates[i].versioned != candidates[j].versioned {
+			return candidates[i].versioned
+		}
+		return candidates[i].versioned && compareVersions(candidates[i].version, candidates[j].version) > 0
+	})
+	return candidates[0].tag, nil
+}
+
+func (s *TagSelector) describe() string {
+	var parts []string
+	if s.constraint != nil {
+		parts = append(parts, fmt.Sprintf("version '%s'", s.version))
+	}
+	if s.pattern != nil {
+		parts = append(parts, fmt.Sprintf("tag_pattern '%s'", s.pattern))
+	}
+	return strings.Join(parts, " and ")
+}
@@ -0,0 +1,97 @@
+package main
+
+import "testing"
+
+func TestParseVersion(t *testing.T) {
+	tests := []struct {
+		tag        string
+		parts      []int
+		prerelease string
+	}{
+		{"v1.15.3", []int{1, 15, 3}, ""},
+		{"release-2.0", []int{2, 0}, ""},
+		{"1.15-beta2", []int{1, 15}, "beta2"},
+		{"3.3.5-1", []int{3, 3, 5, 1}, ""},
+		{"v2.3.1-classic", []int{2, 3, 1}, ""},
+		{"1.0.0+build7", []int{1, 0, 0}, ""},
+		{"3.1-rc.1", []int{3, 1}, "rc.1"},
+	}
+	for _, test := range tests {
+		version, ok := parseVersion(test.tag)
+		if !ok {
+			t.Errorf("%s: not parsed", test.tag)
+			continue
+		}
+		if compareVersions(version, Version{Parts: test.parts, Prerelease: test.prerelease}) != 0 || version.Prerelease != test.prerelease {
+			t.Errorf("%s: got %+v, want %v %q", test.tag, version, test.parts, test.prerelease)
+		}
+	}
+}
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"1.2", "1.2.0", 0},
+		{"1.10", "1.9", 1},
+		{"2.0-beta1", "2.0", -1},
+		{"2.0-beta10", "2.0-beta2", 1},
+		{"2.0-alpha3", "2.0-beta1", -1},
+		{"2.0-rc.2", "2.0-rc.11", -1},
+		{"3.3.5-2", "3.3.5", 1},
+	}
+	for _, test := range tests {
+		a, _ := parseVersion(test.a)
+		b, _ := parseVersion(test.b)
+		if got := compareVersions(a, b); got != test.want {
+			t.Errorf("compare %s to %s: got %d, want %d", test.a, test.b, got, test.want)
+		}
+	}
+}
+
+func TestVersionConstraints(t *testing.T) {
+	tests := []struct {
+		constraint string
+		version    string
+		want       bool
+	}{
+		{">=1.0", "1.0", true},
+		{">=1.0", "0.9", false},
+		{">= 1.0", "1.2", true},
+		{">= 1.0", "0.9", false},
+		{">= 1.0 < 2.0", "1.9.9", true},
+		{">= 1.0 < 2.0", "2.0", false},
+		{"^ 1.15", "1.16", true},
+		{"^1.15", "2.0", false},
+		{"^0.3", "0.4", false},
+		{"~1.2", "1.2.9", true},
+		{"~1.2", "1.3", false},
+		{"1.x", "1.99", true},
+		{"1.x", "2.0", false},
+		{"1.15", "1.15.3", true},
+		{"= 1.15.3", "1.15.3", true},
+		{"<1.0 || >=2.0", "2.1", true},
+		{"<1.0 || >=2.0", "1.5", false},
+		{"< 1.0 || >= 2.0", "0.5", true},
+	}
+	for _, test := range tests {
+		constraint, err := parseConstraint(test.constraint)
+		if err != nil {
+			t.Errorf("%q: %v", test.constraint, err)
+			continue
+		}
+		version, _ := parseVersion(test.version)
+		if got := constraint.matches(version, version.Prerelease != ""); got != test.want {
+			t.Errorf("%q matches %s: got %v, want %v", test.constraint, test.version, got, test.want)
+		}
+	}
+}
+
+func TestInvalidVersionConstraints(t *testing.T) {
+	for _, constraint := range []string{"", ">=", ">= ", "1.0 ||", ">=abc"} {
+		if _, err := parseConstraint(constraint); err == nil {
+			t.Errorf("%q: expected an error", constraint)
+		}
+	}
+}
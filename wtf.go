@@ -0,0 +1,66 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Top-level folder holding the WTF directory inside full backups
+const wtfBackupFolder = "WTF"
+
+// Find the WTF directory of the game client an AddOns directory belongs to.
+// AddOns lives in <client>/Interface/AddOns and settings in <client>/WTF.
+func findWTFDirectory(addonsPath string) string {
+	clientDir := filepath.Dir(filepath.Dir(addonsPath))
+
+	entries, err := os.ReadDir(clientDir)
+	if err != nil {
+		return ""
+	}
+
+	// Match case-insensitively, the folder is "WTF" on Windows but may differ elsewhere
+	for _, entry := range entries {
+		if entry.IsDir() && strings.EqualFold(entry.Name(), wtfBackupFolder) {
+			return filepath.Join(clientDir, entry.Name())
+		}
+	}
+	return ""
+}
+
+// Default blacklist for files in WTF that aren't worth backing up
+func getDefaultWTFBlacklist() []string {
+	return []string{
+		"*.bak",
+		"*.old",
+		"Thumbs.db",
+		".DS_Store",
+	}
+}
+
+func wtfBlacklist(dirConfig DirectoryConfig) []string {
+	if len(dirConfig.WTFBlacklist) == 0 {
+		return getDefaultWTFBlacklist()
+	}
+	return dirConfig.WTFBlacklist
+}
+
+// Check a path relative to WTF against the blacklist, by file name or full path
+func shouldExcludeFromWTFBackup(relPath string, blacklist []string) bool {
+	relPath = filepath.ToSlash(relPath)
+	name := filepath.Base(relPath)
+	for _, pattern := range blacklist {
+		if matchesPattern(name, pattern) || matchesPattern(relPath, pattern) {
+			return true
+		}
+	}
+	return false
+}
+
+// Exclusion filter for walking the WTF directory during backups
+func wtfExclude(dirConfig DirectoryConfig) func(relPath string) bool {
+	blacklist := wtfBlacklist(dirConfig)
+	return func(relPath string) bool {
+		return shouldExcludeFromWTFBackup(relPath, blacklist)
+	}
+}